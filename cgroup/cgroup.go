@@ -237,8 +237,8 @@ func (fs FS) cgGetPath(controller string, subpath string, suffix string) (string
 	case MountModeLegacy:
 		joined = filepath.Join(fs.legacyPath, dn, subpath, suffix)
 	case MountModeHybrid:
-		// cpu.stat exists in the unified tree
-		if controller == "cpu" {
+		// cpu.stat exists in the unified tree, as does the process hierarchy maintained by systemd
+		if controller == "cpu" || controller == "systemd" {
 			joined = filepath.Join(fs.unifiedPath, subpath, suffix)
 		} else {
 			joined = filepath.Join(fs.legacyPath, dn, subpath, suffix)
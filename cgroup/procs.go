@@ -0,0 +1,104 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroup
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NewProcs will locate and read the process IDs of all processes in the provided
+// systemd cgroup subpath, including those in nested (e.g. delegated) cgroups.
+func NewProcs(controlGroupMode ControlGroupMode, mountPointPrefix string, cgSubpath string) ([]int, error) {
+	fs, err := NewDefaultFS(controlGroupMode, mountPointPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return fs.NewProcs(cgSubpath)
+}
+
+// NewProcs returns the sorted process IDs listed in cgroup.procs of the given cgroup
+// and all of its descendants.
+func (fs FS) NewProcs(cgSubpath string) ([]int, error) {
+	cgPath, err := fs.cgGetPath("systemd", cgSubpath, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get systemd controller path")
+	}
+
+	var pids []int
+	err = filepath.Walk(cgPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// The cgroup may be removed while we walk it
+			if os.IsNotExist(err) && path != cgPath {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || info.Name() != "cgroup.procs" {
+			return nil
+		}
+
+		b, err := ReadFileNoStat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return errors.Wrapf(err, "unable to read file %s", path)
+		}
+		procs, err := parseProcs(b)
+		if err != nil {
+			return errors.Wrapf(err, "unable to parse contents of file %s", path)
+		}
+		pids = append(pids, procs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// Example cgroup.procs
+// 1042
+// 1043
+func parseProcs(b []byte) ([]int, error) {
+	var pids []int
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		pid, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse %s as int", text)
+		}
+		pids = append(pids, pid)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return pids, nil
+}
@@ -0,0 +1,43 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewProcs(t *testing.T) {
+	have, err := getHybridFixtures(t).NewProcs("/system.slice/foo.service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{1042, 1043, 1101}; !reflect.DeepEqual(have, expected) {
+		t.Errorf("Wrong hybrid pids. Wanted %v got %v", expected, have)
+	}
+
+	have, err = getLegacyFixtures(t).NewProcs("/system.slice/foo.service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{1042}; !reflect.DeepEqual(have, expected) {
+		t.Errorf("Wrong legacy pids. Wanted %v got %v", expected, have)
+	}
+
+	if _, err := getLegacyFixtures(t).NewProcs("foobar"); err == nil {
+		t.Errorf("expected error getting pids for bogus cgroup")
+	}
+}
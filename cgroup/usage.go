@@ -0,0 +1,77 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroup
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NewMemoryUsage will locate and read the memory usage of the provided systemd cgroup subpath.
+func NewMemoryUsage(controlGroupMode ControlGroupMode, mountPointPrefix string, cgSubpath string) (uint64, error) {
+	fs, err := NewDefaultFS(controlGroupMode, mountPointPrefix)
+	if err != nil {
+		return 0, err
+	}
+	return fs.NewMemoryUsage(cgSubpath)
+}
+
+// NewMemoryUsage returns the memory usage in bytes of the cgroup and all of its descendants, from memory.current
+// on the unified hierarchy or memory.usage_in_bytes on the legacy memory controller.
+func (fs FS) NewMemoryUsage(cgSubpath string) (uint64, error) {
+	suffix := "memory.usage_in_bytes"
+	if fs.cgroupUnified == MountModeUnified {
+		suffix = "memory.current"
+	}
+	cgPath, err := fs.cgGetPath("memory", cgSubpath, suffix)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to get memory controller path")
+	}
+	return readUint64File(cgPath)
+}
+
+// NewTasks will locate and read the number of tasks of the provided systemd cgroup subpath.
+func NewTasks(controlGroupMode ControlGroupMode, mountPointPrefix string, cgSubpath string) (uint64, error) {
+	fs, err := NewDefaultFS(controlGroupMode, mountPointPrefix)
+	if err != nil {
+		return 0, err
+	}
+	return fs.NewTasks(cgSubpath)
+}
+
+// NewTasks returns the number of tasks in the cgroup and all of its descendants from pids.current.
+func (fs FS) NewTasks(cgSubpath string) (uint64, error) {
+	cgPath, err := fs.cgGetPath("pids", cgSubpath, "pids.current")
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to get pids controller path")
+	}
+	return readUint64File(cgPath)
+}
+
+func readUint64File(path string) (uint64, error) {
+	b, err := ReadFileNoStat(path)
+	if err != nil {
+		return 0, err
+	}
+	text := strings.TrimSpace(string(b))
+	v, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to parse contents of file %s", path)
+	}
+	return v, nil
+}
@@ -0,0 +1,68 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroup
+
+import (
+	"testing"
+)
+
+func TestNewMemoryUsage(t *testing.T) {
+	unified, err := newFS(MountModeUnified, testFixturesUnified, "")
+	if err != nil {
+		t.Fatal("Unable to create unified test fixtures")
+	}
+	have, err := unified.NewMemoryUsage("/system.slice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := uint64(1073741824); have != expected {
+		t.Errorf("Wrong unified memory usage. Wanted %d got %d", expected, have)
+	}
+
+	have, err = getLegacyFixtures(t).NewMemoryUsage("/system.slice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := uint64(2147483648); have != expected {
+		t.Errorf("Wrong legacy memory usage. Wanted %d got %d", expected, have)
+	}
+}
+
+func TestNewTasks(t *testing.T) {
+	unified, err := newFS(MountModeUnified, testFixturesUnified, "")
+	if err != nil {
+		t.Fatal("Unable to create unified test fixtures")
+	}
+	have, err := unified.NewTasks("/system.slice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := uint64(42); have != expected {
+		t.Errorf("Wrong unified tasks. Wanted %d got %d", expected, have)
+	}
+
+	have, err = getHybridFixtures(t).NewTasks("/system.slice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := uint64(17); have != expected {
+		t.Errorf("Wrong hybrid tasks. Wanted %d got %d", expected, have)
+	}
+
+	if _, err := getLegacyFixtures(t).NewTasks("foobar"); err == nil {
+		t.Errorf("expected error getting tasks of bogus cgroup")
+	}
+}
@@ -16,12 +16,14 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"sync"
 
 	"github.com/kadaan/systemd_exporter/systemd"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/log"
@@ -81,6 +83,14 @@ func mainCore() string {
 			"web.max-requests",
 			"Maximum number of parallel scrape requests. Use 0 to disable.",
 		).Default("40").Int()
+		dependencyGraphPath = kingpin.Flag(
+			"web.dependency-graph-path",
+			"Path under which to expose the unit dependency graph as JSON, or as Graphviz DOT with ?format=dot. Select the manager with ?manager=<name> of --collector.manager.",
+		).Default("/dependencies").String()
+		probePath = kingpin.Flag(
+			"web.probe-path",
+			"Path under which to expose the metrics of the systemd manager reachable through the D-Bus address of the target parameter.",
+		).Default("/probe").String()
 	)
 
 	log.AddFlags(kingpin.CommandLine)
@@ -122,12 +132,62 @@ func mainCore() string {
 	}
 
 	http.Handle(*metricsPath, handler)
+	http.HandleFunc(*dependencyGraphPath, func(w http.ResponseWriter, r *http.Request) {
+		graph, err := collector.DependencyGraph(r.URL.Query().Get("manager"))
+		if errors.Cause(err) == systemd.ErrUnknownManager {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Errorf("couldn't get dependency graph: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		switch format := r.URL.Query().Get("format"); format {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(graph)
+		case "dot":
+			w.Header().Set("Content-Type", "text/vnd.graphviz")
+			err = graph.WriteDOT(w)
+		default:
+			http.Error(w, "unknown format "+format+", expected json or dot", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Errorf("couldn't write response: %s", err)
+		}
+	})
+	http.HandleFunc(*probePath, func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+		probe, err := collector.NewProbe(target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		if err := registry.Register(probe); err != nil {
+			log.Errorf("couldn't register probe collector: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+			ErrorLog:      log.NewErrorLogger(),
+			ErrorHandling: promhttp.ContinueOnError,
+		}).ServeHTTP(w, r)
+	})
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte(`<html>
 			<head><title>Systemd Exporter</title></head>
 			<body>
 			<h1>Systemd Exporter</h1>
 			<p><a href="` + *metricsPath + `">Metrics</a></p>
+			<p><a href="` + *dependencyGraphPath + `">Dependency graph</a> (<a href="` + *dependencyGraphPath + `?format=dot">DOT</a>)</p>
 			</body>
 			</html>`))
 		if err != nil {
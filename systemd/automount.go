@@ -0,0 +1,76 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"strings"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// automountMountUnit returns the mount unit backing an automount unit. Systemd requires both to be named after
+// their mount point, e.g. mnt-nfs.automount and mnt-nfs.mount.
+func automountMountUnit(name string) string {
+	return strings.TrimSuffix(name, ".automount") + ".mount"
+}
+
+// collectAutomountMetrics reports the mount point of an automount unit, the mode of directories it creates, its idle
+// timeout and whether the backing mount unit is currently mounted.
+func (c *Collector) collectAutomountMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus) error {
+	automountProperties, err := conn.GetUnitTypeProperties(unit.Name, "Automount")
+	if err != nil {
+		return errors.Wrapf(err, errGetPropertyMsg, "Where")
+	}
+	where, ok := automountProperties["Where"].(string)
+	if !ok {
+		return errors.Errorf(errConvertStringPropertyMsg, "Where", automountProperties["Where"])
+	}
+	directoryMode, ok := automountProperties["DirectoryMode"].(uint32)
+	if !ok {
+		return errors.Errorf(errConvertUint32PropertyMsg, "DirectoryMode", automountProperties["DirectoryMode"])
+	}
+	timeoutIdle, ok := automountProperties["TimeoutIdleUSec"].(uint64)
+	if !ok {
+		return errors.Errorf(errConvertUint64PropertyMsg, "TimeoutIdleUSec", automountProperties["TimeoutIdleUSec"])
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.automountInfo, prometheus.GaugeValue, 1.0,
+		unit.Name, where)
+	ch <- prometheus.MustNewConstMetric(
+		c.automountDirectoryMode, prometheus.GaugeValue,
+		float64(directoryMode), unit.Name)
+	ch <- prometheus.MustNewConstMetric(
+		c.automountTimeoutIdle, prometheus.GaugeValue,
+		float64(timeoutIdle)/1e6, unit.Name)
+
+	mountUnit := automountMountUnit(unit.Name)
+	activeStateProperty, err := conn.GetUnitProperty(mountUnit, "ActiveState")
+	if err != nil {
+		return errors.Wrapf(err, errGetPropertyMsg, "ActiveState")
+	}
+	activeState, ok := activeStateProperty.Value.Value().(string)
+	if !ok {
+		return errors.Errorf(errConvertStringPropertyMsg, "ActiveState", activeStateProperty.Value.Value())
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.automountMounted, prometheus.GaugeValue,
+		boolToFloat64(activeState == "active"), unit.Name, mountUnit)
+
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/kadaan/systemd_exporter/cgroup"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// containerScopeRE matches the scopes Docker and Podman place containers in with the systemd cgroup driver, e.g.
+// docker-<id>.scope or libpod-<id>.scope. Podman's libpod-conmon-<id>.scope holds the monitor, not the container.
+var containerScopeRE = regexp.MustCompile(`^(docker|libpod)-([0-9a-f]{64})\.scope$`)
+
+var containerRuntimes = map[string]string{
+	"docker": "docker",
+	"libpod": "podman",
+}
+
+// decodeContainerScope returns the container runtime and full container ID of a container scope.
+func decodeContainerScope(name string) (string, string, bool) {
+	m := containerScopeRE.FindStringSubmatch(name)
+	if m == nil {
+		return "", "", false
+	}
+	return containerRuntimes[m[1]], m[2], true
+}
+
+// containerMetadata is the name and image of a container from its runtime's local state.
+type containerMetadata struct {
+	Name  string
+	Image string
+}
+
+// readDockerContainer reads the name and image of a container from <docker root>/containers/<id>/config.v2.json.
+func readDockerContainer(root string, id string) (containerMetadata, error) {
+	b, err := cgroup.ReadFileNoStat(filepath.Join(root, "containers", id, "config.v2.json"))
+	if err != nil {
+		return containerMetadata{}, err
+	}
+	var config struct {
+		Name   string
+		Config struct {
+			Image string
+		}
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return containerMetadata{}, errors.Wrapf(err, "couldn't parse docker config of container %s", id)
+	}
+	return containerMetadata{Name: strings.TrimPrefix(config.Name, "/"), Image: config.Config.Image}, nil
+}
+
+// parsePodmanContainers parses the containers.json of containers/storage, whose metadata field holds the name and
+// image Podman created the container with as JSON encoded string.
+func parsePodmanContainers(b []byte) (map[string]containerMetadata, error) {
+	var containers []struct {
+		ID       string `json:"id"`
+		Metadata string `json:"metadata"`
+	}
+	if err := json.Unmarshal(b, &containers); err != nil {
+		return nil, err
+	}
+	parsed := make(map[string]containerMetadata, len(containers))
+	for _, container := range containers {
+		var metadata struct {
+			Name      string `json:"name"`
+			ImageName string `json:"image-name"`
+		}
+		if container.Metadata != "" {
+			if err := json.Unmarshal([]byte(container.Metadata), &metadata); err != nil {
+				return nil, errors.Wrapf(err, "couldn't parse metadata of container %s", container.ID)
+			}
+		}
+		parsed[container.ID] = containerMetadata{Name: metadata.Name, Image: metadata.ImageName}
+	}
+	return parsed, nil
+}
+
+// podmanContainers caches the parsed containers.json of containers/storage until it changes, as every container
+// scope would otherwise parse the metadata of all containers on each scrape.
+type podmanContainers struct {
+	mtx        sync.Mutex
+	modTime    time.Time
+	containers map[string]containerMetadata
+}
+
+func (p *podmanContainers) get(root string, id string) (containerMetadata, error) {
+	path := filepath.Join(root, "overlay-containers", "containers.json")
+	info, err := os.Stat(path)
+	if err != nil {
+		return containerMetadata{}, err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.containers == nil || !info.ModTime().Equal(p.modTime) {
+		b, err := cgroup.ReadFileNoStat(path)
+		if err != nil {
+			return containerMetadata{}, err
+		}
+		containers, err := parsePodmanContainers(b)
+		if err != nil {
+			return containerMetadata{}, errors.Wrapf(err, "couldn't parse %s", path)
+		}
+		p.containers, p.modTime = containers, info.ModTime()
+	}
+	return p.containers[id], nil
+}
+
+// collectContainerMetrics reports the runtime, ID, name and image of Docker and Podman container scopes. The name
+// and image are left empty if the runtime's local state isn't readable below --path.rootfs.
+func (c *Collector) collectContainerMetrics(ch chan<- prometheus.Metric, unit dbus.UnitStatus) error {
+	runtime, id, ok := decodeContainerScope(unit.Name)
+	if !ok {
+		return nil
+	}
+
+	var metadata containerMetadata
+	var err error
+	switch runtime {
+	case "docker":
+		metadata, err = readDockerContainer(rootfsFilePath(*dockerRoot), id)
+	case "podman":
+		metadata, err = c.podmanContainers.get(rootfsFilePath(*podmanRoot), id)
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.unitContainerInfo, prometheus.GaugeValue, 1.0,
+		unit.Name, runtime, id, metadata.Name, metadata.Image)
+
+	if err != nil && !os.IsNotExist(err) && !os.IsPermission(err) {
+		return errors.Wrapf(err, "couldn't read %s container %s", runtime, id)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var dependencyKinds = []string{"Requires", "Wants", "BindsTo", "PartOf"}
+
+// unitActiveStates maps the names of all units known to systemd to their ActiveState.
+func unitActiveStates(units []dbus.UnitStatus) map[string]string {
+	states := make(map[string]string, len(units))
+	for _, unit := range units {
+		states[unit.Name] = unit.ActiveState
+	}
+	return states
+}
+
+// isUnmetDependency reports whether a dependency of the given kind is not satisfied. A failed dependency is always
+// unmet. Requires= and BindsTo= dependencies must also be loaded and active, while Wants= and PartOf= dependencies
+// may legitimately be inactive, e.g. oneshot services which already finished.
+func isUnmetDependency(kind string, activeState string, loaded bool) bool {
+	if activeState == "failed" {
+		return true
+	}
+	if kind != "Requires" && kind != "BindsTo" {
+		return false
+	}
+	return !loaded || (activeState != "active" && activeState != "activating" && activeState != "reloading")
+}
+
+// collectUnitDependencyMetrics reports how many Requires, Wants, BindsTo and PartOf dependencies a unit has and how
+// many of them are unmet, so a target which is reached but degraded is visible.
+func (c *Collector) collectUnitDependencyMetrics(ch chan<- prometheus.Metric, unit dbus.UnitStatus, unitProperties map[string]interface{}, activeStates map[string]string) error {
+	for _, kind := range dependencyKinds {
+		dependencies, ok := unitProperties[kind].([]string)
+		if !ok {
+			return errors.Errorf(errConvertArrayPropertyMsg, kind, unitProperties[kind])
+		}
+		unmet := 0
+		for _, dependency := range dependencies {
+			activeState, loaded := activeStates[dependency]
+			if isUnmetDependency(kind, activeState, loaded) {
+				unmet++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.unitDependencies, prometheus.GaugeValue,
+			float64(len(dependencies)), unit.Name, kind)
+		ch <- prometheus.MustNewConstMetric(
+			c.unitDependenciesUnmet, prometheus.GaugeValue,
+			float64(unmet), unit.Name, kind)
+	}
+	return nil
+}
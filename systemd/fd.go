@@ -0,0 +1,117 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// File descriptor types exported by systemd_unit_open_fds
+var fdTypesName = []string{"socket", "pipe", "eventfd", "anon_inode", "file", "other"}
+
+// classifyFileDescriptor returns the type of file descriptor based on its /proc/X/fd link target, e.g.
+// socket:[12345], pipe:[12345], anon_inode:[eventfd] or /var/log/foo.log
+func classifyFileDescriptor(target string) string {
+	switch {
+	case strings.HasPrefix(target, "socket:"):
+		return "socket"
+	case strings.HasPrefix(target, "pipe:"):
+		return "pipe"
+	case target == "anon_inode:[eventfd]":
+		return "eventfd"
+	case strings.HasPrefix(target, "anon_inode:"):
+		return "anon_inode"
+	case strings.HasPrefix(target, "/"):
+		return "file"
+	default:
+		return "other"
+	}
+}
+
+// collectServiceFDTypeMetrics counts the open file descriptors of every process of the service by type, and reports
+// how close the process closest to its RLIMIT_NOFILE is to running out of file descriptors.
+func (c *Collector) collectServiceFDTypeMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus, cgroupPath *string) error {
+	pids, err := c.unitPIDs(conn, unit, cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	if len(pids) == 0 {
+		return nil
+	}
+
+	fdTypes := map[string]int{}
+	var maxUtilization float64
+	for _, pid := range pids {
+		utilization, err := c.addProcessFDTypes(fdTypes, pid)
+		if err != nil {
+			// The process may have exited since we listed it
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrap(err, "couldn't get process file descriptors")
+		}
+		if utilization > maxUtilization {
+			maxUtilization = utilization
+		}
+	}
+
+	unitType := parseUnitType(unit)
+	for _, fdType := range fdTypesName {
+		ch <- prometheus.MustNewConstMetric(
+			c.unitOpenFDs, prometheus.GaugeValue,
+			float64(fdTypes[fdType]), unit.Name, unitType, fdType)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.fdUtilization, prometheus.GaugeValue,
+		maxUtilization, unit.Name, processScopeAll)
+
+	return nil
+}
+
+// addProcessFDTypes adds the file descriptors of a process to fdTypes by type, and returns the ratio of open file
+// descriptors to the process' limit.
+func (c *Collector) addProcessFDTypes(fdTypes map[string]int, pid int) (float64, error) {
+	p, err := c.procFS.Proc(pid)
+	if err != nil {
+		return 0, err
+	}
+	targets, err := p.FileDescriptorTargets()
+	if err != nil {
+		return 0, err
+	}
+	limits, err := p.Limits()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, target := range targets {
+		fdTypes[classifyFileDescriptor(target)]++
+	}
+	return fdUtilization(len(targets), limits.OpenFiles), nil
+}
+
+func fdUtilization(fds int, limit uint64) float64 {
+	// Unlimited is reported as math.MaxUint64 and works out to ~0 by itself, only guard against dividing by zero
+	if limit == 0 {
+		return 0
+	}
+	return float64(fds) / float64(limit)
+}
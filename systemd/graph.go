@@ -0,0 +1,174 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// graphEdgeKinds are the dependencies included in the dependency graph, with the edge color used by
+// systemd-analyze dot where it has one.
+var graphEdgeKinds = []struct {
+	Kind  string
+	Color string
+}{
+	{"Requires", "black"},
+	{"Wants", "grey66"},
+	{"After", "green"},
+	{"Before", "darkgreen"},
+	{"Conflicts", "red"},
+}
+
+// DependencyGraphNode is a unit in the dependency graph.
+type DependencyGraphNode struct {
+	Name        string `json:"name"`
+	ActiveState string `json:"active_state"`
+}
+
+// DependencyGraphEdge is a dependency of kind Requires, Wants, After, Before or Conflicts from one unit on another.
+type DependencyGraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// DependencyGraph is the dependency graph of the units matched by the unit allowlist and blocklist.
+type DependencyGraph struct {
+	Nodes []DependencyGraphNode `json:"nodes"`
+	Edges []DependencyGraphEdge `json:"edges"`
+}
+
+// cachedDependencyGraph is a dependency graph and when it was resolved.
+type cachedDependencyGraph struct {
+	graph *DependencyGraph
+	time  time.Time
+}
+
+// DependencyGraph returns the dependency graph of all filtered units of the given manager, as named by
+// --collector.manager, e.g. user@1000. An empty manager is the first configured one. Resolving the graph takes a
+// D-Bus call per unit, so it is built by one request at a time and reused for --collector.dependency-graph.cache-ttl.
+func (c *Collector) DependencyGraph(manager string) (*DependencyGraph, error) {
+	target, err := c.findManagerTarget(manager)
+	if err != nil {
+		return nil, err
+	}
+
+	c.dependencyGraphMtx.Lock()
+	defer c.dependencyGraphMtx.Unlock()
+
+	if cached, ok := c.dependencyGraphs[target.name]; ok && time.Since(cached.time) < *dependencyGraphCacheTTL {
+		return cached.graph, nil
+	}
+	graph, err := c.buildDependencyGraph(target)
+	if err != nil {
+		return nil, err
+	}
+	if c.dependencyGraphs == nil {
+		c.dependencyGraphs = make(map[string]cachedDependencyGraph)
+	}
+	c.dependencyGraphs[target.name] = cachedDependencyGraph{graph, time.Now()}
+	return graph, nil
+}
+
+// buildDependencyGraph resolves the dependencies of all filtered units. Units they depend on which are themselves
+// filtered out are still included as nodes, so a failing chain remains visible. Units whose dependencies can't be
+// read are logged and left without edges.
+func (c *Collector) buildDependencyGraph(target managerTarget) (*DependencyGraph, error) {
+	conn, err := target.connect()
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't get dbus connection")
+	}
+	defer conn.Close()
+
+	allUnits, err := conn.ListUnits()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get list of systemd units from dbus")
+	}
+	activeStates := unitActiveStates(allUnits)
+	units := filterUnits(allUnits, c.unitWhitelistPattern, c.unitBlacklistPattern)
+
+	graph := &DependencyGraph{Nodes: []DependencyGraphNode{}, Edges: []DependencyGraphEdge{}}
+	nodes := make(map[string]struct{})
+	addNode := func(name string) {
+		if _, ok := nodes[name]; ok {
+			return
+		}
+		nodes[name] = struct{}{}
+		graph.Nodes = append(graph.Nodes, DependencyGraphNode{Name: name, ActiveState: activeStates[name]})
+	}
+
+	for _, unit := range units {
+		addNode(unit.Name)
+		logger := c.logger.With("unit", unit.Name)
+		unitProperties, err := conn.GetUnitProperties(unit.Name)
+		if err != nil {
+			logger.Warnf(errUnitMetricsMsg, errors.Wrap(err, "couldn't get unit's properties"))
+			continue
+		}
+		for _, edgeKind := range graphEdgeKinds {
+			dependencies, ok := unitProperties[edgeKind.Kind].([]string)
+			if !ok {
+				logger.Warnf(errUnitMetricsMsg, errors.Errorf(errConvertArrayPropertyMsg, edgeKind.Kind, unitProperties[edgeKind.Kind]))
+				continue
+			}
+			for _, dependency := range dependencies {
+				addNode(dependency)
+				graph.Edges = append(graph.Edges, DependencyGraphEdge{From: unit.Name, To: dependency, Kind: edgeKind.Kind})
+			}
+		}
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].Name < graph.Nodes[j].Name })
+	return graph, nil
+}
+
+// WriteDOT writes the dependency graph in the Graphviz DOT format, using the edge colors of systemd-analyze dot and
+// highlighting failed units.
+func (g *DependencyGraph) WriteDOT(w io.Writer) error {
+	colors := make(map[string]string, len(graphEdgeKinds))
+	for _, edgeKind := range graphEdgeKinds {
+		colors[edgeKind.Kind] = edgeKind.Color
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph systemd {")
+	for _, node := range g.Nodes {
+		color := "black"
+		switch node.ActiveState {
+		case "failed":
+			color = "red"
+		case "active":
+			color = "darkgreen"
+		case "":
+			color = "grey66"
+		}
+		fmt.Fprintf(bw, "\t%s [label=%s, color=%s];\n",
+			strconv.Quote(node.Name), strconv.Quote(node.Name+"\n"+node.ActiveState), color)
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(bw, "\t%s->%s [color=%s, label=%s];\n",
+			strconv.Quote(edge.From), strconv.Quote(edge.To), colors[edge.Kind], strconv.Quote(edge.Kind))
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
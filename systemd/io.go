@@ -0,0 +1,104 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"os"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// processIOTotals is the sum of /proc/X/io of a set of processes.
+type processIOTotals struct {
+	RChar               uint64
+	WChar               uint64
+	SyscR               uint64
+	SyscW               uint64
+	ReadBytes           uint64
+	WriteBytes          uint64
+	CancelledWriteBytes int64
+}
+
+func (t *processIOTotals) add(pio procfs.ProcIO) {
+	t.RChar += pio.RChar
+	t.WChar += pio.WChar
+	t.SyscR += pio.SyscR
+	t.SyscW += pio.SyscW
+	t.ReadBytes += pio.ReadBytes
+	t.WriteBytes += pio.WriteBytes
+	t.CancelledWriteBytes += pio.CancelledWriteBytes
+}
+
+// collectUnitProcessIOMetrics sums the IO counters of every process in the unit's control group. This works without
+// blkio/io accounting, but only covers processes which are currently alive. The sums drop when processes exit, so
+// they are exported as gauges rather than counters.
+func (c *Collector) collectUnitProcessIOMetrics(cgSubpath string, ch chan<- prometheus.Metric, unit dbus.UnitStatus) error {
+	pids, err := c.controlGroupPIDs(cgSubpath)
+	if err != nil {
+		return err
+	}
+	if len(pids) == 0 {
+		return nil
+	}
+
+	var totals processIOTotals
+	for _, pid := range pids {
+		p, err := c.procFS.Proc(pid)
+		if err != nil {
+			// The process may have exited since we listed it
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		pio, err := p.IO()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrap(err, "couldn't get process io")
+		}
+		totals.add(pio)
+	}
+
+	unitType := parseUnitType(unit)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitIOReadChars, prometheus.GaugeValue,
+		float64(totals.RChar), unit.Name, unitType)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitIOWriteChars, prometheus.GaugeValue,
+		float64(totals.WChar), unit.Name, unitType)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitIOReadSyscalls, prometheus.GaugeValue,
+		float64(totals.SyscR), unit.Name, unitType)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitIOWriteSyscalls, prometheus.GaugeValue,
+		float64(totals.SyscW), unit.Name, unitType)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitIOReadBytes, prometheus.GaugeValue,
+		float64(totals.ReadBytes), unit.Name, unitType)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitIOWriteBytes, prometheus.GaugeValue,
+		float64(totals.WriteBytes), unit.Name, unitType)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitIOCancelledWriteBytes, prometheus.GaugeValue,
+		float64(totals.CancelledWriteBytes), unit.Name, unitType)
+
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// kubernetesQOSClasses maps the cgroup names kubelet uses for pod QoS classes to the class names of the pod API.
+// Guaranteed pods are placed directly below kubepods.
+var kubernetesQOSClasses = map[string]string{
+	"burstable":  "Burstable",
+	"besteffort": "BestEffort",
+}
+
+var (
+	// e.g. cri-containerd-<id>, crio-<id>, docker-<id> or a bare <id> with the cgroupfs driver
+	kubernetesContainerRE = regexp.MustCompile(`^(?:(?:cri-containerd|crio|docker)-)?([0-9a-f]{64})$`)
+	kubernetesPodRE       = regexp.MustCompile(`^pod([0-9a-fA-F_-]{36})$`)
+)
+
+// kubernetesCgroup is what kubelet encodes in the cgroup of a pod or container.
+type kubernetesCgroup struct {
+	QOSClass    string
+	PodUID      string
+	ContainerID string
+}
+
+// decodeKubernetesControlGroup decodes the QoS class, pod UID and container ID from the cgroup path of a unit below
+// kubepods. Both the systemd cgroup driver, e.g.
+// /kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice/cri-containerd-<id>.scope, where
+// dashes of the pod UID are escaped as underscores, and the cgroupfs driver, e.g. /kubepods/burstable/pod<uid>/<id>,
+// are understood.
+func decodeKubernetesControlGroup(cgroupPath string) (kubernetesCgroup, bool) {
+	var decoded kubernetesCgroup
+	kubepods := false
+	for _, segment := range strings.Split(strings.Trim(cgroupPath, "/"), "/") {
+		segment = strings.TrimSuffix(strings.TrimSuffix(segment, ".slice"), ".scope")
+		if !kubepods {
+			kubepods = segment == "kubepods"
+			continue
+		}
+		// With the systemd driver every slice name repeats its parents, e.g. kubepods-burstable-pod<uid>
+		if i := strings.LastIndex(segment, "-pod"); strings.HasPrefix(segment, "kubepods-") && i >= 0 {
+			segment = segment[i+1:]
+		} else {
+			segment = strings.TrimPrefix(segment, "kubepods-")
+		}
+
+		if qosClass, ok := kubernetesQOSClasses[segment]; ok {
+			decoded.QOSClass = qosClass
+		} else if m := kubernetesPodRE.FindStringSubmatch(segment); m != nil {
+			decoded.PodUID = strings.Replace(m[1], "_", "-", -1)
+		} else if m := kubernetesContainerRE.FindStringSubmatch(segment); m != nil {
+			decoded.ContainerID = m[1]
+		}
+	}
+	if !kubepods {
+		return kubernetesCgroup{}, false
+	}
+	if decoded.QOSClass == "" && decoded.PodUID != "" {
+		decoded.QOSClass = "Guaranteed"
+	}
+	return decoded, true
+}
+
+// collectKubernetesMetrics reports the pod and container of kubelet's slices and scopes, so their metrics can be
+// joined with kube-state-metrics.
+func (c *Collector) collectKubernetesMetrics(ch chan<- prometheus.Metric, unit dbus.UnitStatus, cgroupPath string) {
+	decoded, ok := decodeKubernetesControlGroup(cgroupPath)
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.unitKubernetesInfo, prometheus.GaugeValue, 1.0,
+		unit.Name, decoded.QOSClass, decoded.PodUID, decoded.ContainerID)
+}
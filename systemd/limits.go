@@ -0,0 +1,178 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strconv"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// limitResource maps a resource limit between its /proc/X/limits description and the systemd unit property.
+type limitResource struct {
+	// Description in /proc/X/limits
+	proc string
+	// Value of the resource label, the lower case suffix of the unit property
+	name string
+	// Hard limit unit property on the Service interface, the soft limit has a Soft suffix
+	property string
+}
+
+var limitResources = []limitResource{
+	{"Max cpu time", "cpu", "LimitCPU"},
+	{"Max file size", "fsize", "LimitFSIZE"},
+	{"Max data size", "data", "LimitDATA"},
+	{"Max stack size", "stack", "LimitSTACK"},
+	{"Max core file size", "core", "LimitCORE"},
+	{"Max resident set", "rss", "LimitRSS"},
+	{"Max processes", "nproc", "LimitNPROC"},
+	{"Max open files", "nofile", "LimitNOFILE"},
+	{"Max locked memory", "memlock", "LimitMEMLOCK"},
+	{"Max address space", "as", "LimitAS"},
+	{"Max file locks", "locks", "LimitLOCKS"},
+	{"Max pending signals", "sigpending", "LimitSIGPENDING"},
+	{"Max msgqueue size", "msgqueue", "LimitMSGQUEUE"},
+	{"Max nice priority", "nice", "LimitNICE"},
+	{"Max realtime priority", "rtprio", "LimitRTPRIO"},
+	{"Max realtime timeout", "rttime", "LimitRTTIME"},
+}
+
+// Example /proc/X/limits line
+// Max open files            1024                 524288               files
+var limitsLine = regexp.MustCompile(`^(Max [a-z]+(?: [a-z]+)*)\s{2,}(\w+)\s+(\w+)`)
+
+// processLimit is the soft and hard value of a resource limit. Unlimited is +Inf.
+type processLimit struct {
+	Soft float64
+	Hard float64
+}
+
+// parseProcessLimits parses /proc/X/limits into a map keyed by the resource label.
+func parseProcessLimits(b []byte) (map[string]processLimit, error) {
+	names := make(map[string]string, len(limitResources))
+	for _, resource := range limitResources {
+		names[resource.proc] = resource.name
+	}
+
+	limits := map[string]processLimit{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := limitsLine.FindStringSubmatch(scanner.Text())
+		if fields == nil {
+			continue
+		}
+		name, ok := names[fields[1]]
+		if !ok {
+			continue
+		}
+		soft, err := parseLimitValue(fields[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse soft limit of %q", fields[1])
+		}
+		hard, err := parseLimitValue(fields[3])
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse hard limit of %q", fields[1])
+		}
+		limits[name] = processLimit{Soft: soft, Hard: hard}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+func parseLimitValue(s string) (float64, error) {
+	if s == "unlimited" {
+		return math.Inf(1), nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return float64(v), nil
+}
+
+// unitLimitValue converts a Limit* unit property, where infinity is math.MaxUint64, into a metric value.
+func unitLimitValue(v uint64) float64 {
+	if v == math.MaxUint64 {
+		return math.Inf(1)
+	}
+	return float64(v)
+}
+
+// collectServiceLimitMetrics reports every resource limit of the service's main process, along with the limits
+// configured on the unit, so that a process which changed its own limits or wasn't restarted after the unit file
+// changed can be spotted. The limits of the process are only read for managers sharing the exporter's host.
+func (c *Collector) collectServiceLimitMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus, scope managerScope) error {
+	serviceProperties, err := conn.GetUnitTypeProperties(unit.Name, "Service")
+	if err != nil {
+		return errors.Wrapf(err, errGetPropertyMsg, "Limit*")
+	}
+	for _, resource := range limitResources {
+		for kind, property := range map[string]string{"hard": resource.property, "soft": resource.property + "Soft"} {
+			value, ok := serviceProperties[property].(uint64)
+			if !ok {
+				// Older versions of systemd don't have all limits
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				c.serviceLimit, prometheus.GaugeValue,
+				unitLimitValue(value), unit.Name, resource.name, kind)
+		}
+	}
+
+	if !scope.sharesHost() {
+		return nil
+	}
+	pid, ok := serviceProperties["MainPID"].(uint32)
+	if !ok {
+		return errors.Errorf(errConvertUint32PropertyMsg, "MainPID", serviceProperties["MainPID"])
+	}
+	// MainPID 0 when the service currently has no main PID
+	if pid == 0 {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(c.procFilePath(int(pid), "limits"))
+	if err != nil {
+		return errors.Wrap(err, "couldn't get process limits")
+	}
+	limits, err := parseProcessLimits(b)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get process limits")
+	}
+	for _, resource := range limitResources {
+		limit, ok := limits[resource.name]
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.processLimit, prometheus.GaugeValue,
+			limit.Soft, unit.Name, resource.name, "soft")
+		ch <- prometheus.MustNewConstMetric(
+			c.processLimit, prometheus.GaugeValue,
+			limit.Hard, unit.Name, resource.name, "hard")
+	}
+
+	return nil
+}
@@ -0,0 +1,409 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"os"
+	"strconv"
+
+	godbus "github.com/godbus/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+const (
+	logindBusName    = "org.freedesktop.login1"
+	logindObjectPath = godbus.ObjectPath("/org/freedesktop/login1")
+	logindSubsystem  = "logind"
+)
+
+var (
+	logindSessionStatesName = []string{"online", "active", "closing"}
+	logindUserStatesName    = []string{"offline", "lingering", "online", "active", "closing"}
+)
+
+// logindSession holds the properties of an org.freedesktop.login1.Session.
+type logindSession struct {
+	ID         string
+	UID        uint32
+	User       string
+	Seat       string
+	Type       string
+	Class      string
+	State      string
+	RemoteHost string
+	Scope      string
+	Idle       bool
+	IdleSince  uint64
+}
+
+// logindUser holds the properties of an org.freedesktop.login1.User.
+type logindUser struct {
+	UID         uint32
+	Name        string
+	State       string
+	Linger      bool
+	RuntimePath string
+	Slice       string
+	Sessions    int
+}
+
+// logindSeat holds the properties of an org.freedesktop.login1.Seat.
+type logindSeat struct {
+	ID            string
+	ActiveSession string
+	Sessions      int
+}
+
+// logindCollector exports the sessions, users and seats of systemd-logind.
+type logindCollector struct {
+	sessionInfo      *prometheus.Desc
+	sessionState     *prometheus.Desc
+	sessionIdle      *prometheus.Desc
+	sessionIdleSince *prometheus.Desc
+	userInfo         *prometheus.Desc
+	userState        *prometheus.Desc
+	userLinger       *prometheus.Desc
+	userSessions     *prometheus.Desc
+	seatInfo         *prometheus.Desc
+	seatSessions     *prometheus.Desc
+
+	logger log.Logger
+}
+
+func newLogindCollector(logger log.Logger) *logindCollector {
+	return &logindCollector{
+		logger: logger,
+		sessionInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logindSubsystem, "session_info"),
+			"Static information about a logind session, name is the session's scope unit",
+			[]string{"name", "session", "uid", "user", "seat", "type", "class", "remote_host"}, nil,
+		),
+		sessionState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logindSubsystem, "session_state"),
+			"State of the logind session",
+			[]string{"session", "state"}, nil,
+		),
+		sessionIdle: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logindSubsystem, "session_idle"),
+			"Whether the logind session is idle",
+			[]string{"session"}, nil,
+		),
+		sessionIdleSince: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logindSubsystem, "session_idle_since_timestamp_seconds"),
+			"Time the logind session became idle",
+			[]string{"session"}, nil,
+		),
+		userInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logindSubsystem, "user_info"),
+			"Static information about a logged in or lingering user, name is the user's slice unit",
+			[]string{"name", "uid", "user", "runtime_path"}, nil,
+		),
+		userState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logindSubsystem, "user_state"),
+			"State of the logind user",
+			[]string{"uid", "state"}, nil,
+		),
+		userLinger: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logindSubsystem, "user_linger"),
+			"Whether the user's service manager is kept running without a session",
+			[]string{"uid"}, nil,
+		),
+		userSessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logindSubsystem, "user_sessions"),
+			"Number of sessions of the user",
+			[]string{"uid"}, nil,
+		),
+		seatInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logindSubsystem, "seat_info"),
+			"Seat known to logind with its active session",
+			[]string{"seat", "active_session"}, nil,
+		),
+		seatSessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logindSubsystem, "seat_sessions"),
+			"Number of sessions on the seat",
+			[]string{"seat"}, nil,
+		),
+	}
+}
+
+func (l *logindCollector) describe(desc chan<- *prometheus.Desc) {
+	desc <- l.sessionInfo
+	desc <- l.sessionState
+	desc <- l.sessionIdle
+	desc <- l.sessionIdleSince
+	desc <- l.userInfo
+	desc <- l.userState
+	desc <- l.userLinger
+	desc <- l.userSessions
+	desc <- l.seatInfo
+	desc <- l.seatSessions
+}
+
+// newLogindConnection connects to the system bus separately from the systemd connection, which may be the private
+// systemd socket or a user bus where logind isn't available.
+func newLogindConnection() (*godbus.Conn, error) {
+	return dbusAuthHelloConnection(godbus.SystemBusPrivate, os.Getuid())
+}
+
+func (l *logindCollector) collect(ch chan<- prometheus.Metric) error {
+	conn, err := newLogindConnection()
+	if err != nil {
+		return errors.Wrap(err, "couldn't get logind dbus connection")
+	}
+	defer conn.Close()
+
+	// A session, user or seat which can't be parsed is skipped, so the others are still reported
+	sessions, err := listLogindObjects(conn, "ListSessions", "Session")
+	if err != nil {
+		return err
+	}
+	for _, properties := range sessions {
+		session, err := parseLogindSession(properties)
+		if err != nil {
+			l.logger.Warnf("couldn't parse logind session: %s", err)
+			continue
+		}
+		l.collectSession(ch, session)
+	}
+
+	users, err := listLogindObjects(conn, "ListUsers", "User")
+	if err != nil {
+		return err
+	}
+	for _, properties := range users {
+		user, err := parseLogindUser(properties)
+		if err != nil {
+			l.logger.Warnf("couldn't parse logind user: %s", err)
+			continue
+		}
+		l.collectUser(ch, user)
+	}
+
+	seats, err := listLogindObjects(conn, "ListSeats", "Seat")
+	if err != nil {
+		return err
+	}
+	for _, properties := range seats {
+		seat, err := parseLogindSeat(properties)
+		if err != nil {
+			l.logger.Warnf("couldn't parse logind seat: %s", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			l.seatInfo, prometheus.GaugeValue, 1.0,
+			seat.ID, seat.ActiveSession)
+		ch <- prometheus.MustNewConstMetric(
+			l.seatSessions, prometheus.GaugeValue,
+			float64(seat.Sessions), seat.ID)
+	}
+
+	return nil
+}
+
+func (l *logindCollector) collectSession(ch chan<- prometheus.Metric, session logindSession) {
+	ch <- prometheus.MustNewConstMetric(
+		l.sessionInfo, prometheus.GaugeValue, 1.0,
+		session.Scope, session.ID, strconv.FormatUint(uint64(session.UID), 10), session.User, session.Seat,
+		session.Type, session.Class, session.RemoteHost)
+	for _, stateName := range logindSessionStatesName {
+		ch <- prometheus.MustNewConstMetric(
+			l.sessionState, prometheus.GaugeValue,
+			boolToFloat64(stateName == session.State), session.ID, stateName)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		l.sessionIdle, prometheus.GaugeValue,
+		boolToFloat64(session.Idle), session.ID)
+	if session.Idle && session.IdleSince > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			l.sessionIdleSince, prometheus.GaugeValue,
+			float64(session.IdleSince)/1e6, session.ID)
+	}
+}
+
+func (l *logindCollector) collectUser(ch chan<- prometheus.Metric, user logindUser) {
+	uid := strconv.FormatUint(uint64(user.UID), 10)
+	ch <- prometheus.MustNewConstMetric(
+		l.userInfo, prometheus.GaugeValue, 1.0,
+		user.Slice, uid, user.Name, user.RuntimePath)
+	for _, stateName := range logindUserStatesName {
+		ch <- prometheus.MustNewConstMetric(
+			l.userState, prometheus.GaugeValue,
+			boolToFloat64(stateName == user.State), uid, stateName)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		l.userLinger, prometheus.GaugeValue,
+		boolToFloat64(user.Linger), uid)
+	ch <- prometheus.MustNewConstMetric(
+		l.userSessions, prometheus.GaugeValue,
+		float64(user.Sessions), uid)
+}
+
+// listLogindObjects lists the sessions, users or seats of logind and returns the properties of each. The object
+// path is the last member of the structs returned by the List* methods.
+func listLogindObjects(conn *godbus.Conn, method string, iface string) ([]map[string]godbus.Variant, error) {
+	var objects [][]interface{}
+	err := conn.Object(logindBusName, logindObjectPath).Call(logindBusName+".Manager."+method, 0).Store(&objects)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't call logind %s", method)
+	}
+
+	properties := make([]map[string]godbus.Variant, 0, len(objects))
+	for _, object := range objects {
+		if len(object) == 0 {
+			continue
+		}
+		path, ok := object[len(object)-1].(godbus.ObjectPath)
+		if !ok {
+			return nil, errors.Errorf("couldn't convert logind %s object path %v", method, object[len(object)-1])
+		}
+		var objectProperties map[string]godbus.Variant
+		err := conn.Object(logindBusName, path).Call("org.freedesktop.DBus.Properties.GetAll", 0, logindBusName+"."+iface).Store(&objectProperties)
+		if err != nil {
+			// The session, user or seat may be gone by now
+			continue
+		}
+		properties = append(properties, objectProperties)
+	}
+	return properties, nil
+}
+
+func parseLogindSession(properties map[string]godbus.Variant) (logindSession, error) {
+	var session logindSession
+	var err error
+	for property, value := range map[string]*string{
+		"Id":         &session.ID,
+		"Type":       &session.Type,
+		"Class":      &session.Class,
+		"State":      &session.State,
+		"RemoteHost": &session.RemoteHost,
+		"Scope":      &session.Scope,
+		"Name":       &session.User,
+	} {
+		if *value, err = logindString(properties, property); err != nil {
+			return logindSession{}, err
+		}
+	}
+	if session.UID, _, err = logindObjectRef(properties, "User"); err != nil {
+		return logindSession{}, err
+	}
+	if session.Seat, err = logindNamedObjectRef(properties, "Seat"); err != nil {
+		return logindSession{}, err
+	}
+	if session.Idle, err = logindBool(properties, "IdleHint"); err != nil {
+		return logindSession{}, err
+	}
+	idleSince, ok := properties["IdleSinceHint"].Value().(uint64)
+	if !ok {
+		return logindSession{}, errors.Errorf(errConvertUint64PropertyMsg, "IdleSinceHint", properties["IdleSinceHint"].Value())
+	}
+	session.IdleSince = idleSince
+	return session, nil
+}
+
+func parseLogindUser(properties map[string]godbus.Variant) (logindUser, error) {
+	var user logindUser
+	var err error
+	for property, value := range map[string]*string{
+		"Name":        &user.Name,
+		"State":       &user.State,
+		"RuntimePath": &user.RuntimePath,
+		"Slice":       &user.Slice,
+	} {
+		if *value, err = logindString(properties, property); err != nil {
+			return logindUser{}, err
+		}
+	}
+	uid, ok := properties["UID"].Value().(uint32)
+	if !ok {
+		return logindUser{}, errors.Errorf(errConvertUint32PropertyMsg, "UID", properties["UID"].Value())
+	}
+	user.UID = uid
+	if user.Linger, err = logindBool(properties, "Linger"); err != nil {
+		return logindUser{}, err
+	}
+	if user.Sessions, err = logindArrayLen(properties, "Sessions"); err != nil {
+		return logindUser{}, err
+	}
+	return user, nil
+}
+
+func parseLogindSeat(properties map[string]godbus.Variant) (logindSeat, error) {
+	var seat logindSeat
+	var err error
+	if seat.ID, err = logindString(properties, "Id"); err != nil {
+		return logindSeat{}, err
+	}
+	if seat.ActiveSession, err = logindNamedObjectRef(properties, "ActiveSession"); err != nil {
+		return logindSeat{}, err
+	}
+	if seat.Sessions, err = logindArrayLen(properties, "Sessions"); err != nil {
+		return logindSeat{}, err
+	}
+	return seat, nil
+}
+
+func logindString(properties map[string]godbus.Variant, property string) (string, error) {
+	value, ok := properties[property].Value().(string)
+	if !ok {
+		return "", errors.Errorf(errConvertStringPropertyMsg, property, properties[property].Value())
+	}
+	return value, nil
+}
+
+func logindBool(properties map[string]godbus.Variant, property string) (bool, error) {
+	value, ok := properties[property].Value().(bool)
+	if !ok {
+		return false, errors.Errorf(errConvertBoolPropertyMsg, property, properties[property].Value())
+	}
+	return value, nil
+}
+
+func logindArrayLen(properties map[string]godbus.Variant, property string) (int, error) {
+	value, ok := properties[property].Value().([][]interface{})
+	if !ok {
+		return 0, errors.Errorf(errConvertArrayPropertyMsg, property, properties[property].Value())
+	}
+	return len(value), nil
+}
+
+// logindObjectRef decodes a (uo) reference such as the User of a session.
+func logindObjectRef(properties map[string]godbus.Variant, property string) (uint32, godbus.ObjectPath, error) {
+	value, ok := properties[property].Value().([]interface{})
+	if !ok || len(value) != 2 {
+		return 0, "", errors.Errorf(errConvertArrayPropertyMsg, property, properties[property].Value())
+	}
+	id, ok := value[0].(uint32)
+	if !ok {
+		return 0, "", errors.Errorf(errConvertUint32PropertyMsg, property, value[0])
+	}
+	path, _ := value[1].(godbus.ObjectPath)
+	return id, path, nil
+}
+
+// logindNamedObjectRef decodes the name of a (so) reference such as the Seat of a session, which is empty if unset.
+func logindNamedObjectRef(properties map[string]godbus.Variant, property string) (string, error) {
+	value, ok := properties[property].Value().([]interface{})
+	if !ok || len(value) != 2 {
+		return "", errors.Errorf(errConvertArrayPropertyMsg, property, properties[property].Value())
+	}
+	name, ok := value[0].(string)
+	if !ok {
+		return "", errors.Errorf(errConvertStringPropertyMsg, property, value[0])
+	}
+	return name, nil
+}
@@ -0,0 +1,292 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/dbus"
+	godbus "github.com/godbus/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// labeledMetric adds labels to a metric, so the metrics of several systemd instances can be told apart without
+// changing every descriptor.
+type labeledMetric struct {
+	prometheus.Metric
+	labels []*dto.LabelPair
+}
+
+func (m labeledMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	out.Label = append(out.Label, m.labels...)
+	sort.Slice(out.Label, func(i, j int) bool { return out.Label[i].GetName() < out.Label[j].GetName() })
+	return nil
+}
+
+// collectWithLabels runs collect and adds the given labels to every metric it sends to ch.
+func collectWithLabels(ch chan<- prometheus.Metric, labels map[string]string, collect func(chan<- prometheus.Metric) error) error {
+	if len(labels) == 0 {
+		return collect(ch)
+	}
+	labelPairs := make([]*dto.LabelPair, 0, len(labels))
+	for name, value := range labels {
+		name, value := name, value
+		labelPairs = append(labelPairs, &dto.LabelPair{Name: &name, Value: &value})
+	}
+
+	labeled := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for metric := range labeled {
+			ch <- labeledMetric{Metric: metric, labels: labelPairs}
+		}
+		close(done)
+	}()
+	err := collect(labeled)
+	close(labeled)
+	<-done
+	return err
+}
+
+// userManagerSockets returns the private sockets of all running user managers, by uid.
+func userManagerSockets() (map[int]string, error) {
+	runUser := rootfsFilePath("/run/user")
+	entries, err := ioutil.ReadDir(runUser)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sockets := make(map[int]string, len(entries))
+	for _, entry := range entries {
+		userUID, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		socket := filepath.Join(runUser, entry.Name(), "systemd", "private")
+		if info, err := os.Stat(socket); err != nil || info.Mode()&os.ModeSocket == 0 {
+			continue
+		}
+		sockets[userUID] = socket
+	}
+	return sockets, nil
+}
+
+// newUserManagerConnection connects to the private socket of a user manager. Unlike the user's session bus, the user
+// manager accepts root next to the user itself, so the exporter authenticates with its own uid. The private socket
+// isn't a bus, so like dbus.NewSystemdConnection the Hello is skipped.
+func newUserManagerConnection(socket string) (*dbus.Conn, error) {
+	return dbus.NewConnection(func() (*godbus.Conn, error) {
+		return dbusAuthConnection(func(opts ...godbus.ConnOption) (*godbus.Conn, error) {
+			return godbus.Dial("unix:path="+socket, opts...)
+		}, os.Getuid())
+	})
+}
+
+// ErrUnknownManager is returned for a manager which is neither configured nor found.
+var ErrUnknownManager = errors.New("unknown systemd manager")
+
+// managerScope tells how much of the exporter's host a systemd manager shares with its units.
+type managerScope int
+
+const (
+	// userScope is a user manager, whose socket units aren't bound by PID 1
+	userScope managerScope = iota
+	// systemScope is the system manager, whose socket units are bound in the network namespace of PID 1
+	systemScope
+	// probeScope is a manager reached through the probe endpoint, e.g. in a container, whose processes, cgroups and
+	// files may live in other namespaces than the exporter's
+	probeScope
+)
+
+// sharesHost reports whether the processes, cgroups and files of the manager's units are the ones of --path.procfs,
+// the cgroupfs and --path.rootfs. Otherwise only what the manager reports over D-Bus is collected.
+func (s managerScope) sharesHost() bool {
+	return s != probeScope
+}
+
+// managerTarget is a systemd manager to collect and the labels added to its metrics.
+type managerTarget struct {
+	name    string
+	labels  map[string]string
+	connect func() (*dbus.Conn, error)
+	scope   managerScope
+}
+
+// newManagerTargets parses the --collector.manager targets. Without targets, the manager selected by
+// --collector.private and --collector.user is collected without additional labels, or next to the user managers of
+// --collector.enable-user-managers with the labels of the manager it connects to.
+func newManagerTargets(targets []string) ([]managerTarget, error) {
+	if len(targets) == 0 {
+		target := managerTarget{name: "default", connect: newDefaultConnection, scope: systemScope}
+		// Matches the order in which newDefaultConnection picks the manager
+		if !*systemdPrivate && *systemdUser {
+			target.scope = userScope
+		}
+		if *enableUserManagers {
+			target.labels = map[string]string{"manager": "system"}
+			if target.scope == userScope {
+				target.labels = map[string]string{"manager": "user", "uid": strconv.Itoa(*uid)}
+			}
+		}
+		return []managerTarget{target}, nil
+	}
+
+	parsed := make([]managerTarget, 0, len(targets))
+	seen := make(map[string]struct{}, len(targets))
+	for _, target := range targets {
+		managerTarget, err := parseManagerTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		key := managerTarget.labels["manager"] + "/" + managerTarget.labels["uid"]
+		if _, ok := seen[key]; ok {
+			return nil, errors.Errorf("--collector.manager %s collects the same manager as an earlier target", target)
+		}
+		seen[key] = struct{}{}
+		parsed = append(parsed, managerTarget)
+	}
+	return parsed, nil
+}
+
+func parseManagerTarget(target string) (managerTarget, error) {
+	switch {
+	case target == "system":
+		return managerTarget{target, map[string]string{"manager": "system"}, dbus.New, systemScope}, nil
+	case target == "private":
+		return managerTarget{target, map[string]string{"manager": "system"}, dbus.NewSystemdConnection, systemScope}, nil
+	case target == "user":
+		return managerTarget{target, map[string]string{"manager": "user", "uid": strconv.Itoa(*uid)}, newUserConnection, userScope}, nil
+	case strings.HasPrefix(target, "user@"):
+		userUID, err := strconv.Atoi(strings.TrimPrefix(target, "user@"))
+		if err != nil || userUID < 0 {
+			return managerTarget{}, errors.Errorf("invalid --collector.manager %s, expected user@<uid>", target)
+		}
+		return newUserManagerTarget(userUID, rootfsFilePath(filepath.Join("/run/user", strconv.Itoa(userUID), "systemd", "private"))), nil
+	default:
+		return managerTarget{}, errors.Errorf("invalid --collector.manager %s, expected system, private, user or user@<uid>", target)
+	}
+}
+
+func newUserManagerTarget(userUID int, socket string) managerTarget {
+	return managerTarget{
+		name:   "user@" + strconv.Itoa(userUID),
+		labels: map[string]string{"manager": "user", "uid": strconv.Itoa(userUID)},
+		connect: func() (*dbus.Conn, error) {
+			return newUserManagerConnection(socket)
+		},
+		scope: userScope,
+	}
+}
+
+func newDefaultConnection() (*dbus.Conn, error) {
+	if *systemdPrivate {
+		return dbus.NewSystemdConnection()
+	}
+	if *systemdUser {
+		return newUserConnection()
+	}
+	return dbus.New()
+}
+
+// userManagerTargets returns the user managers found by --collector.enable-user-managers which aren't already
+// configured with --collector.manager.
+func (c *Collector) userManagerTargets() ([]managerTarget, error) {
+	sockets, err := userManagerSockets()
+	if err != nil {
+		return nil, err
+	}
+	configured := make(map[string]struct{}, len(c.managerTargets))
+	for _, target := range c.managerTargets {
+		if target.labels["manager"] == "user" {
+			configured[target.labels["uid"]] = struct{}{}
+		}
+	}
+
+	userUIDs := make([]int, 0, len(sockets))
+	for userUID := range sockets {
+		if _, ok := configured[strconv.Itoa(userUID)]; !ok {
+			userUIDs = append(userUIDs, userUID)
+		}
+	}
+	sort.Ints(userUIDs)
+	targets := make([]managerTarget, 0, len(userUIDs))
+	for _, userUID := range userUIDs {
+		targets = append(targets, newUserManagerTarget(userUID, sockets[userUID]))
+	}
+	return targets, nil
+}
+
+// findManagerTarget returns the manager target of the given --collector.manager name, or of a user manager found by
+// --collector.enable-user-managers. An empty name is the first configured target.
+func (c *Collector) findManagerTarget(name string) (managerTarget, error) {
+	if name == "" && len(c.managerTargets) > 0 {
+		return c.managerTargets[0], nil
+	}
+	for _, target := range c.managerTargets {
+		if target.name == name {
+			return target, nil
+		}
+	}
+	if *enableUserManagers {
+		userTargets, err := c.userManagerTargets()
+		if err != nil {
+			return managerTarget{}, err
+		}
+		for _, target := range userTargets {
+			if target.name == name {
+				return target, nil
+			}
+		}
+	}
+	return managerTarget{}, errors.Wrapf(ErrUnknownManager, "%s", name)
+}
+
+// collectManagerTarget collects the units of a manager with its labels, together with whether and how fast that
+// succeeded. A user manager which can't be reached, e.g. because its user logged out meanwhile, only fails its own
+// target.
+func (c *Collector) collectManagerTarget(ch chan<- prometheus.Metric, target managerTarget) error {
+	return collectWithLabels(ch, target.labels, func(ch chan<- prometheus.Metric) error {
+		begin := time.Now()
+		conn, err := target.connect()
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't get dbus connection")
+		} else {
+			err = c.collectManager(conn, ch, target.scope)
+			conn.Close()
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			c.managerScrapeSuccess, prometheus.GaugeValue,
+			boolToFloat64(err == nil))
+		ch <- prometheus.MustNewConstMetric(
+			c.managerScrapeDuration, prometheus.GaugeValue,
+			time.Since(begin).Seconds())
+		return err
+	})
+}
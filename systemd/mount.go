@@ -0,0 +1,142 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"time"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+// filesystemStats is the capacity of a mounted filesystem as reported by statfs(2).
+type filesystemStats struct {
+	SizeBytes  uint64
+	FreeBytes  uint64
+	AvailBytes uint64
+	Files      uint64
+	FilesFree  uint64
+}
+
+var statfsFunc = unix.Statfs
+
+func statFilesystem(path string) (filesystemStats, error) {
+	var buf unix.Statfs_t
+	if err := statfsFunc(path, &buf); err != nil {
+		return filesystemStats{}, err
+	}
+	bsize := uint64(buf.Bsize)
+	return filesystemStats{
+		SizeBytes:  buf.Blocks * bsize,
+		FreeBytes:  buf.Bfree * bsize,
+		AvailBytes: buf.Bavail * bsize,
+		Files:      buf.Files,
+		FilesFree:  buf.Ffree,
+	}, nil
+}
+
+// collectMountMetrics reports what and where a mount unit mounts with which options and, for active mounts, the
+// capacity of the mounted filesystem if it is mounted on the exporter's host.
+func (c *Collector) collectMountMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus, scope managerScope) error {
+	mountProperties, err := conn.GetUnitTypeProperties(unit.Name, "Mount")
+	if err != nil {
+		return errors.Wrapf(err, errGetPropertyMsg, "Where")
+	}
+	labels := make([]string, 0, 3)
+	for _, property := range []string{"What", "Where", "Options"} {
+		value, ok := mountProperties[property].(string)
+		if !ok {
+			return errors.Errorf(errConvertStringPropertyMsg, property, mountProperties[property])
+		}
+		labels = append(labels, value)
+	}
+	where := labels[1]
+
+	ch <- prometheus.MustNewConstMetric(
+		c.mountInfo, prometheus.GaugeValue, 1.0,
+		append([]string{unit.Name}, labels...)...)
+
+	if !*enableMountFilesystemMetrics || unit.ActiveState != "active" || !scope.sharesHost() {
+		return nil
+	}
+	stats, err := c.statMount(where)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't statfs %s", where)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.mountSizeBytes, prometheus.GaugeValue,
+		float64(stats.SizeBytes), unit.Name)
+	ch <- prometheus.MustNewConstMetric(
+		c.mountFreeBytes, prometheus.GaugeValue,
+		float64(stats.FreeBytes), unit.Name)
+	ch <- prometheus.MustNewConstMetric(
+		c.mountAvailBytes, prometheus.GaugeValue,
+		float64(stats.AvailBytes), unit.Name)
+	ch <- prometheus.MustNewConstMetric(
+		c.mountFiles, prometheus.GaugeValue,
+		float64(stats.Files), unit.Name)
+	ch <- prometheus.MustNewConstMetric(
+		c.mountFilesFree, prometheus.GaugeValue,
+		float64(stats.FilesFree), unit.Name)
+
+	return nil
+}
+
+// statfsCall is a statfs(2) of a mount point which may still be running.
+type statfsCall struct {
+	done     chan struct{}
+	stats    filesystemStats
+	err      error
+	timedOut bool
+}
+
+// statMount runs statfs(2) on a mount point with a timeout, as it blocks indefinitely on unresponsive network
+// filesystems. Concurrent scrapes wait for the result of the statfs which is already running for a mount point, while
+// a mount point whose statfs timed out is skipped until that call returns.
+func (c *Collector) statMount(where string) (filesystemStats, error) {
+	c.statfsCallsMtx.Lock()
+	call, ok := c.statfsCalls[where]
+	if ok && call.timedOut {
+		c.statfsCallsMtx.Unlock()
+		return filesystemStats{}, errors.New("previous statfs of the mount point hasn't returned yet")
+	}
+	if !ok {
+		call = &statfsCall{done: make(chan struct{})}
+		c.statfsCalls[where] = call
+		go func() {
+			stats, err := statFilesystem(rootfsFilePath(where))
+
+			c.statfsCallsMtx.Lock()
+			call.stats, call.err = stats, err
+			delete(c.statfsCalls, where)
+			c.statfsCallsMtx.Unlock()
+			close(call.done)
+		}()
+	}
+	c.statfsCallsMtx.Unlock()
+
+	select {
+	case <-call.done:
+		return call.stats, call.err
+	case <-time.After(*mountStatfsTimeout):
+		c.statfsCallsMtx.Lock()
+		call.timedOut = true
+		c.statfsCallsMtx.Unlock()
+		return filesystemStats{}, errors.Errorf("statfs timed out after %s", *mountStatfsTimeout)
+	}
+}
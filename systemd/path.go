@@ -0,0 +1,67 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectPathMetrics reports the paths watched by a path unit, its result and when it last triggered its unit.
+func (c *Collector) collectPathMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus) error {
+	pathProperties, err := conn.GetUnitTypeProperties(unit.Name, "Path")
+	if err != nil {
+		return errors.Wrapf(err, errGetPropertyMsg, "Paths")
+	}
+
+	paths, err := parseStringPairs("Paths", pathProperties["Paths"])
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		ch <- prometheus.MustNewConstMetric(
+			c.pathInfo, prometheus.GaugeValue, 1.0,
+			unit.Name, path[0], path[1])
+	}
+
+	result, ok := pathProperties["Result"].(string)
+	if !ok {
+		return errors.Errorf(errConvertStringPropertyMsg, "Result", pathProperties["Result"])
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.pathResult, prometheus.GaugeValue, 1.0,
+		unit.Name, result)
+
+	// Path units don't record when they fire, so use the time their unit last left the inactive state
+	triggeredUnit, ok := pathProperties["Unit"].(string)
+	if !ok {
+		return errors.Errorf(errConvertStringPropertyMsg, "Unit", pathProperties["Unit"])
+	}
+	timestampValue, err := conn.GetUnitProperty(triggeredUnit, "InactiveExitTimestamp")
+	if err != nil {
+		return errors.Wrapf(err, errGetPropertyMsg, "InactiveExitTimestamp")
+	}
+	timestamp, ok := timestampValue.Value.Value().(uint64)
+	if !ok {
+		return errors.Errorf(errConvertUint64PropertyMsg, "InactiveExitTimestamp", timestampValue.Value.Value())
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.pathLastTrigger, prometheus.GaugeValue,
+		float64(timestamp)/1e6, unit.Name, triggeredUnit)
+
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/go-systemd/dbus"
+	godbus "github.com/godbus/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// probeCollector collects the units of the systemd manager reachable through a single D-Bus address.
+type probeCollector struct {
+	c      *Collector
+	target managerTarget
+}
+
+// NewProbe returns a collector for the systemd manager reachable through the given D-Bus address, e.g.
+// unix:path=/var/lib/machines/foo/run/dbus/system_bus_socket. It shares the filters and enabled collectors of c.
+// Only a single local socket with an absolute path matching --collector.probe.target-allowlist is accepted, so
+// clients of the probe endpoint can't make the exporter connect to arbitrary hosts. The allowlist is matched against
+// the cleaned path, and the exporter connects to an address rebuilt from it, so neither a list of addresses nor ..
+// elements can reach a socket outside of the allowlist.
+func (c *Collector) NewProbe(address string) (prometheus.Collector, error) {
+	path := strings.TrimPrefix(address, "unix:path=")
+	if path == address || path == "" || strings.ContainsAny(path, ",;") || !filepath.IsAbs(path) {
+		return nil, errors.Errorf("invalid D-Bus address %s, expected unix:path=<absolute socket path>", address)
+	}
+	path = filepath.Clean(path)
+	if !c.probeTargetPattern.MatchString(path) {
+		return nil, errors.Errorf("D-Bus socket %s isn't allowed by --collector.probe.target-allowlist", path)
+	}
+	address = "unix:path=" + path
+	return &probeCollector{
+		c: c,
+		target: managerTarget{
+			name: address,
+			connect: func() (*dbus.Conn, error) {
+				return newProbeConnection(address)
+			},
+			scope: probeScope,
+		},
+	}, nil
+}
+
+// newProbeConnection connects to address with EXTERNAL auth as the exporter's own uid, which is what the other end
+// sees as the credentials of the socket. The private socket of systemd isn't a bus, so like
+// dbus.NewSystemdConnection the Hello is skipped for it.
+func newProbeConnection(address string) (*dbus.Conn, error) {
+	createBus := func(opts ...godbus.ConnOption) (*godbus.Conn, error) {
+		return godbus.Dial(address, opts...)
+	}
+	return dbus.NewConnection(func() (*godbus.Conn, error) {
+		if isSystemdPrivateAddress(address) {
+			return dbusAuthConnection(createBus, os.Getuid())
+		}
+		return dbusAuthHelloConnection(createBus, os.Getuid())
+	})
+}
+
+func isSystemdPrivateAddress(address string) bool {
+	for _, param := range strings.Split(strings.TrimPrefix(address, "unix:"), ",") {
+		if strings.HasPrefix(param, "path=") && strings.HasSuffix(param, "/systemd/private") {
+			return strings.HasPrefix(address, "unix:")
+		}
+	}
+	return false
+}
+
+// Describe gathers descriptions of Metrics
+func (p *probeCollector) Describe(desc chan<- *prometheus.Desc) {
+	p.c.Describe(desc)
+}
+
+// Collect fetches the stats from the probed systemd manager and delivers them as Prometheus metrics. Only what the
+// manager reports over D-Bus is collected, as the exporter can't tell where its units' processes and files live.
+func (p *probeCollector) Collect(ch chan<- prometheus.Metric) {
+	err := p.c.collectManagerTarget(ch, p.target)
+	if err != nil {
+		p.c.logger.Errorf("couldn't probe systemd manager %s: %s", p.target.name, err)
+	}
+}
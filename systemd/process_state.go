@@ -0,0 +1,146 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// Scheduler states exported by systemd_unit_processes, see proc(5)
+var processStatesName = []string{"R", "S", "D", "Z", "T"}
+
+// processStateTotals counts the processes of a unit by scheduler state, along with their threads and the context
+// switches of those threads.
+type processStateTotals struct {
+	States       map[string]int
+	Threads      int
+	Voluntary    uint64
+	NonVoluntary uint64
+}
+
+func (t *processStateTotals) addStat(stat procfs.ProcStat) {
+	state := stat.State
+	// Stopped by a debugger is still stopped
+	if state == "t" {
+		state = "T"
+	}
+	if t.States == nil {
+		t.States = map[string]int{}
+	}
+	t.States[state]++
+	t.Threads += stat.NumThreads
+}
+
+func (t *processStateTotals) addStatus(status procfs.ProcStatus) {
+	t.Voluntary += status.VoluntaryCtxtSwitches
+	t.NonVoluntary += status.NonVoluntaryCtxtSwitches
+}
+
+// collectServiceProcessStateMetrics reports the scheduler state of every process of the service, the number of
+// threads and their context switches, so that zombie accumulation or tasks stuck in uninterruptible sleep are visible.
+func (c *Collector) collectServiceProcessStateMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus, cgroupPath *string) error {
+	pids, err := c.unitPIDs(conn, unit, cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	if len(pids) == 0 {
+		return nil
+	}
+
+	var totals processStateTotals
+	for _, pid := range pids {
+		err := c.addProcessState(&totals, pid)
+		if err != nil {
+			// The process may have exited since we listed it
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrap(err, "couldn't get process state")
+		}
+	}
+
+	unitType := parseUnitType(unit)
+	for _, state := range processStatesName {
+		ch <- prometheus.MustNewConstMetric(
+			c.unitProcesses, prometheus.GaugeValue,
+			float64(totals.States[state]), unit.Name, unitType, state)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.unitThreads, prometheus.GaugeValue,
+		float64(totals.Threads), unit.Name, unitType)
+	// The context switches of exited threads are lost, so the sum is a gauge rather than a counter
+	ch <- prometheus.MustNewConstMetric(
+		c.unitContextSwitches, prometheus.GaugeValue,
+		float64(totals.Voluntary), unit.Name, unitType, "voluntary")
+	ch <- prometheus.MustNewConstMetric(
+		c.unitContextSwitches, prometheus.GaugeValue,
+		float64(totals.NonVoluntary), unit.Name, unitType, "nonvoluntary")
+
+	return nil
+}
+
+// addProcessState adds the state of a process to totals. /proc/X/status only reports the context switches of the
+// process' main thread, so the status of every thread listed in /proc/X/task is read through its /proc/TID entry.
+func (c *Collector) addProcessState(totals *processStateTotals, pid int) error {
+	p, err := c.procFS.Proc(pid)
+	if err != nil {
+		return err
+	}
+	stat, err := p.Stat()
+	if err != nil {
+		return err
+	}
+
+	tasks, err := ioutil.ReadDir(c.procFilePath(pid, "task"))
+	if err != nil {
+		return err
+	}
+	var taskTotals processStateTotals
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		thread, err := c.procFS.Proc(tid)
+		if err != nil {
+			// The thread may have exited since we listed it
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		status, err := thread.NewStatus()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		taskTotals.addStatus(status)
+	}
+
+	totals.addStat(stat)
+	totals.Voluntary += taskTotals.Voluntary
+	totals.NonVoluntary += taskTotals.NonVoluntary
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"os"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/kadaan/systemd_exporter/cgroup"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// getUnitSlice returns the slice a cgroup backed unit is placed in.
+func getUnitSlice(conn *dbus.Conn, unit dbus.UnitStatus) (string, error) {
+	sliceProperty, err := conn.GetUnitTypeProperty(unit.Name, parseUnitTypeInterface(unit), "Slice")
+	if err != nil {
+		return "", errors.Wrapf(err, errGetPropertyMsg, "Slice")
+	}
+	slice, ok := sliceProperty.Value.Value().(string)
+	if !ok {
+		return "", errors.Errorf(errConvertStringPropertyMsg, "Slice", sliceProperty.Value.Value())
+	}
+	return slice, nil
+}
+
+// unitSlice returns the slice a cgroup backed unit is placed in, or an empty slice if it can't be read, so that
+// unit_info is still reported.
+func (c *Collector) unitSlice(conn *dbus.Conn, unit dbus.UnitStatus) string {
+	slice, err := getUnitSlice(conn, unit)
+	if err != nil {
+		c.logger.With("unit", unit.Name).Warnf(errUnitMetricsMsg, err)
+		return ""
+	}
+	return slice
+}
+
+// collectUnitMetainfo reports unit_info for cgroup backed units without type specific info, so that sockets, swaps,
+// scopes and slices can be grouped by slice as well.
+func (c *Collector) collectUnitMetainfo(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus) {
+	template, instance := parseUnitTemplate(unit.Name)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitInfo, prometheus.GaugeValue, 1.0,
+		unit.Name, parseUnitType(unit), "", "", template, instance, c.unitSlice(conn, unit), unit.Description)
+}
+
+// collectSliceMetrics reports the CPU usage, memory usage and number of tasks of a slice. The kernel accounts them
+// hierarchically, so the slice's own cgroup holds the totals of every unit and slice below it.
+func (c *Collector) collectSliceMetrics(cgSubpath string, ch chan<- prometheus.Metric, unit dbus.UnitStatus) error {
+	cpuUsage, err := cgroup.NewCPUUsage(c.controlGroupMode, c.controlGroupMountPrefix, cgSubpath)
+	if err != nil {
+		if perr, ok := err.(*os.PathError); !ok || perr.Op != "open" {
+			return errors.Wrapf(err, errControlGroupReadMsg, "CPU usage")
+		}
+	} else if cpuUsage != nil {
+		ch <- prometheus.MustNewConstMetric(
+			c.sliceCPUTotal, prometheus.CounterValue,
+			cpuUsage.UserSeconds(), unit.Name, "user")
+		ch <- prometheus.MustNewConstMetric(
+			c.sliceCPUTotal, prometheus.CounterValue,
+			cpuUsage.SystemSeconds(), unit.Name, "system")
+	}
+
+	memoryUsage, err := cgroup.NewMemoryUsage(c.controlGroupMode, c.controlGroupMountPrefix, cgSubpath)
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(
+			c.sliceMemoryBytes, prometheus.GaugeValue,
+			float64(memoryUsage), unit.Name)
+	} else if perr, ok := err.(*os.PathError); !ok || perr.Op != "open" {
+		return errors.Wrapf(err, errControlGroupReadMsg, "memory usage")
+	}
+
+	tasks, err := cgroup.NewTasks(c.controlGroupMode, c.controlGroupMountPrefix, cgSubpath)
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(
+			c.sliceTasks, prometheus.GaugeValue,
+			float64(tasks), unit.Name)
+	} else if perr, ok := err.(*os.PathError); !ok || perr.Op != "open" {
+		return errors.Wrapf(err, errControlGroupReadMsg, "tasks")
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"os"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// smapsTotals is the sum of the smaps_rollup of a set of processes.
+type smapsTotals struct {
+	Pss     uint64
+	Uss     uint64
+	SwapPss uint64
+}
+
+func (t *smapsTotals) add(rollup procfs.ProcSMapsRollup) {
+	t.Pss += rollup.Pss
+	t.Uss += rollup.PrivateClean + rollup.PrivateDirty
+	t.SwapPss += rollup.SwapPss
+}
+
+// collectUnitSmapsMetrics reports the proportional and unique memory of every process in the unit's control group.
+// Unlike the cgroup memory statistics and the resident memory of the main process, these do not double count pages
+// shared with other units.
+func (c *Collector) collectUnitSmapsMetrics(cgSubpath string, ch chan<- prometheus.Metric, unit dbus.UnitStatus) error {
+	pids, err := c.controlGroupPIDs(cgSubpath)
+	if err != nil {
+		return err
+	}
+	if len(pids) == 0 {
+		return nil
+	}
+
+	var totals smapsTotals
+	for _, pid := range pids {
+		rollup, err := c.readSmapsRollup(pid)
+		if err != nil {
+			// The process may have exited since we listed it
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrap(err, "couldn't get process smaps")
+		}
+		totals.add(rollup)
+	}
+
+	unitType := parseUnitType(unit)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitMemPss, prometheus.GaugeValue,
+		float64(totals.Pss), unit.Name, unitType)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitMemUss, prometheus.GaugeValue,
+		float64(totals.Uss), unit.Name, unitType)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitMemSwapPss, prometheus.GaugeValue,
+		float64(totals.SwapPss), unit.Name, unitType)
+
+	return nil
+}
+
+// readSmapsRollup reads the smaps_rollup of a process. The kernel walks every mapping of the process while holding
+// its mmap lock to produce this file, so the number of concurrent reads is capped across all units.
+func (c *Collector) readSmapsRollup(pid int) (procfs.ProcSMapsRollup, error) {
+	c.smapsSemaphore <- struct{}{}
+	defer func() { <-c.smapsSemaphore }()
+
+	p, err := c.procFS.Proc(pid)
+	if err != nil {
+		return procfs.ProcSMapsRollup{}, err
+	}
+	return p.ProcSMapsRollup()
+}
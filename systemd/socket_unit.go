@@ -0,0 +1,133 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// socketListen is an entry of the Listen property of a socket unit, e.g. (Stream, [::]:22)
+type socketListen struct {
+	Type    string
+	Address string
+}
+
+// parseSocketListen decodes the a(ss) Listen property of a socket unit.
+func parseSocketListen(value interface{}) ([]socketListen, error) {
+	pairs, err := parseStringPairs("Listen", value)
+	if err != nil {
+		return nil, err
+	}
+	listens := make([]socketListen, 0, len(pairs))
+	for _, pair := range pairs {
+		listens = append(listens, socketListen{Type: pair[0], Address: pair[1]})
+	}
+	return listens, nil
+}
+
+// listenQueueLength returns the accept queue length of the listening TCP socket bound to a Stream address of a socket
+// unit. A port without an address, e.g. ListenStream=22, is bound to the unspecified address.
+func listenQueueLength(sockets []netSocket, address string) (uint64, bool) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		host, portString = "", address
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		// e.g. a unix socket path
+		return 0, false
+	}
+	ip := net.ParseIP(host)
+
+	for _, socket := range sockets {
+		if socket.State != netSocketStateListen || socket.LocalPort != port {
+			continue
+		}
+		if socket.Protocol != "tcp" && socket.Protocol != "tcp6" {
+			continue
+		}
+		if (ip == nil && socket.LocalAddr.IsUnspecified()) || (ip != nil && ip.Equal(socket.LocalAddr)) {
+			return socket.RxQueue, true
+		}
+	}
+	return 0, false
+}
+
+// collectSocketListenMetrics reports the addresses a socket unit listens on, its configured backlog and connection
+// limit, and how many connections are waiting to be accepted, so socket activated services falling behind are visible.
+// The queues are looked up in the network namespace of PID 1 by address, so they are only reported for the system
+// manager.
+func (c *Collector) collectSocketListenMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus, scope managerScope) error {
+	socketProperties, err := conn.GetUnitTypeProperties(unit.Name, "Socket")
+	if err != nil {
+		return errors.Wrapf(err, errGetPropertyMsg, "Listen")
+	}
+
+	listens, err := parseSocketListen(socketProperties["Listen"])
+	if err != nil {
+		return err
+	}
+	for _, listen := range listens {
+		ch <- prometheus.MustNewConstMetric(
+			c.socketListenInfo, prometheus.GaugeValue, 1.0,
+			unit.Name, listen.Type, listen.Address)
+	}
+
+	backlog, ok := socketProperties["Backlog"].(uint32)
+	if !ok {
+		return errors.Errorf(errConvertUint32PropertyMsg, "Backlog", socketProperties["Backlog"])
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.socketBacklog, prometheus.GaugeValue,
+		float64(backlog), unit.Name)
+
+	maxConnections, ok := socketProperties["MaxConnections"].(uint32)
+	if !ok {
+		return errors.Errorf(errConvertUint32PropertyMsg, "MaxConnections", socketProperties["MaxConnections"])
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.socketMaxConnections, prometheus.GaugeValue,
+		float64(maxConnections), unit.Name)
+
+	if !*enableListenQueueMetrics || scope != systemScope {
+		return nil
+	}
+	var sockets []netSocket
+	for _, listen := range listens {
+		if listen.Type != "Stream" {
+			continue
+		}
+		// Socket units are bound by systemd, so their sockets live in its network namespace
+		if sockets == nil {
+			sockets, err = c.readNetSockets(1)
+			if err != nil {
+				return errors.Wrap(err, "couldn't get network sockets")
+			}
+		}
+		if queue, ok := listenQueueLength(sockets, listen.Address); ok {
+			ch <- prometheus.MustNewConstMetric(
+				c.socketListenQueue, prometheus.GaugeValue,
+				float64(queue), unit.Name, listen.Address)
+		}
+	}
+
+	return nil
+}
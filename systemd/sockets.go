@@ -0,0 +1,270 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Files in /proc/X/net listing the sockets of a network namespace, which are also used as protocol label
+var netSocketProtocols = []string{"tcp", "tcp6", "udp", "udp6"}
+
+// Socket states as defined in include/net/tcp_states.h. UDP sockets reuse these, unconnected UDP sockets are "close".
+var netSocketStates = map[uint64]string{
+	0x01: "established",
+	0x02: "syn_sent",
+	0x03: "syn_recv",
+	0x04: "fin_wait1",
+	0x05: "fin_wait2",
+	0x06: "time_wait",
+	0x07: "close",
+	0x08: "close_wait",
+	0x09: "last_ack",
+	0x0A: "listen",
+	0x0B: "closing",
+	0x0C: "new_syn_recv",
+}
+
+const netSocketStateListen = 0x0A
+
+// netSocket is a line of /proc/X/net/{tcp,udp}{,6}
+type netSocket struct {
+	Protocol  string
+	LocalAddr net.IP
+	LocalPort uint64
+	State     uint64
+	// For listening TCP sockets the number of connections waiting to be accepted
+	RxQueue uint64
+	Inode   uint64
+}
+
+// parseNetSockets parses the contents of /proc/X/net/{tcp,udp}{,6}, e.g.
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+//	 0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 20001 1 ...
+func parseNetSockets(r io.Reader, protocol string) ([]netSocket, error) {
+	var sockets []netSocket
+	scanner := bufio.NewScanner(r)
+	// Skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			return nil, errors.Errorf("malformed %s line: %q", protocol, scanner.Text())
+		}
+
+		local := strings.Split(fields[1], ":")
+		if len(local) != 2 {
+			return nil, errors.Errorf("malformed %s local address: %q", protocol, fields[1])
+		}
+		addr, err := parseNetSocketIP(local[0])
+		if err != nil {
+			return nil, err
+		}
+		port, err := strconv.ParseUint(local[1], 16, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed %s local port", protocol)
+		}
+		state, err := strconv.ParseUint(fields[3], 16, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed %s state", protocol)
+		}
+		queues := strings.Split(fields[4], ":")
+		if len(queues) != 2 {
+			return nil, errors.Errorf("malformed %s queues: %q", protocol, fields[4])
+		}
+		rxQueue, err := strconv.ParseUint(queues[1], 16, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed %s rx_queue", protocol)
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed %s inode", protocol)
+		}
+
+		sockets = append(sockets, netSocket{
+			Protocol:  protocol,
+			LocalAddr: addr,
+			LocalPort: port,
+			State:     state,
+			RxQueue:   rxQueue,
+			Inode:     inode,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sockets, nil
+}
+
+// parseNetSocketIP decodes an address of /proc/X/net/{tcp,udp}{,6}. IPv4 addresses are a little endian word, IPv6
+// addresses are four little endian words.
+func parseNetSocketIP(s string) (net.IP, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, errors.Errorf("malformed socket address %q", s)
+	}
+	ip := make(net.IP, len(b))
+	for i := 0; i < len(b); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	return ip, nil
+}
+
+// readNetSockets reads the TCP and UDP sockets of the network namespace of the given process.
+func (c *Collector) readNetSockets(pid int) ([]netSocket, error) {
+	var sockets []netSocket
+	for _, protocol := range netSocketProtocols {
+		f, err := os.Open(c.procFilePath(pid, "net", protocol))
+		if err != nil {
+			// IPv6 may be disabled
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		s, err := parseNetSockets(f, protocol)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		sockets = append(sockets, s...)
+	}
+	return sockets, nil
+}
+
+// netNamespacePIDs returns one of the given processes for every distinct network namespace among them, identified
+// by /proc/X/ns/net. Processes whose namespace can't be read are assumed to share one namespace.
+func (c *Collector) netNamespacePIDs(pids []int) []int {
+	var nsPIDs []int
+	seen := map[string]struct{}{}
+	for _, pid := range pids {
+		ns, err := os.Readlink(c.procFilePath(pid, "ns", "net"))
+		if err != nil {
+			ns = ""
+		}
+		if _, ok := seen[ns]; ok {
+			continue
+		}
+		seen[ns] = struct{}{}
+		nsPIDs = append(nsPIDs, pid)
+	}
+	return nsPIDs
+}
+
+// socketInode returns the inode of a /proc/X/fd link target of a socket, e.g. socket:[20001]
+func socketInode(target string) (uint64, bool) {
+	if !strings.HasPrefix(target, "socket:[") || !strings.HasSuffix(target, "]") {
+		return 0, false
+	}
+	inode, err := strconv.ParseUint(target[len("socket:["):len(target)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return inode, true
+}
+
+// collectServiceSocketMetrics counts the TCP and UDP sockets held open by the service's processes by state, and the
+// connections waiting to be accepted on its listening sockets.
+func (c *Collector) collectServiceSocketMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus, cgroupPath *string) error {
+	pids, err := c.unitPIDs(conn, unit, cgroupPath, true)
+	if err != nil {
+		return err
+	}
+
+	inodes := map[uint64]struct{}{}
+	for _, pid := range pids {
+		p, err := c.procFS.Proc(pid)
+		if err != nil {
+			// The process may have exited since we listed it
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		targets, err := p.FileDescriptorTargets()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrap(err, "couldn't get process file descriptors")
+		}
+		for _, target := range targets {
+			if inode, ok := socketInode(target); ok {
+				inodes[inode] = struct{}{}
+			}
+		}
+	}
+	if len(inodes) == 0 {
+		return nil
+	}
+
+	// Processes of a unit usually share a network namespace, but may set up their own, e.g. containers. Socket
+	// inodes are unique across namespaces, so the sockets of every namespace can be matched together.
+	var sockets []netSocket
+	for _, pid := range c.netNamespacePIDs(pids) {
+		s, err := c.readNetSockets(pid)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrap(err, "couldn't get network sockets")
+		}
+		sockets = append(sockets, s...)
+	}
+
+	type socketKey struct{ protocol, state string }
+	counts := map[socketKey]int{}
+	listenQueues := map[string]uint64{}
+	for _, socket := range sockets {
+		if _, ok := inodes[socket.Inode]; !ok {
+			continue
+		}
+		// A namespace may have been read twice if its processes' namespaces couldn't be told apart
+		delete(inodes, socket.Inode)
+		state, ok := netSocketStates[socket.State]
+		if !ok {
+			state = "unknown"
+		}
+		counts[socketKey{socket.Protocol, state}]++
+		if socket.State == netSocketStateListen {
+			listenQueues[socket.Protocol] += socket.RxQueue
+		}
+	}
+
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(
+			c.unitSockets, prometheus.GaugeValue,
+			float64(count), unit.Name, key.protocol, key.state)
+	}
+	for protocol, queue := range listenQueues {
+		ch <- prometheus.MustNewConstMetric(
+			c.unitSocketListenQueue, prometheus.GaugeValue,
+			float64(queue), unit.Name, protocol)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// The kernel appends this marker to /proc/X/exe and /proc/X/maps paths whose file was unlinked
+const deletedSuffix = " (deleted)"
+
+// Deleted mappings under these prefixes are not files from a package, e.g. memfd_create(2), shared
+// memory or temporary files, so they never indicate that a restart is needed.
+var staleMappedFileIgnoredPrefixes = []string{"/memfd:", "/dev/", "/SYSV", "/run/", "/tmp/", "/var/tmp/"}
+
+// collectStaleMappedFilesMetrics reports executables and libraries which were replaced on disk (e.g. by a package
+// upgrade) while still being mapped by the service's processes. Such services need a restart to pick up the update.
+func (c *Collector) collectStaleMappedFilesMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus, cgroupPath *string) error {
+	pids, err := c.unitPIDs(conn, unit, cgroupPath, *staleMappedFilesAllProcesses)
+	if err != nil {
+		return err
+	}
+	if len(pids) == 0 {
+		return nil
+	}
+
+	stale := map[string]struct{}{}
+	for _, pid := range pids {
+		p, err := c.procFS.Proc(pid)
+		if err != nil {
+			// The process may have exited since we listed it
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		paths, err := staleMappedFiles(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrap(err, "couldn't get process mapped files")
+		}
+		for _, path := range paths {
+			stale[path] = struct{}{}
+		}
+	}
+
+	unitType := parseUnitType(unit)
+	ch <- prometheus.MustNewConstMetric(
+		c.unitStaleMappedFiles, prometheus.GaugeValue,
+		float64(len(stale)), unit.Name, unitType)
+	for path := range stale {
+		ch <- prometheus.MustNewConstMetric(
+			c.unitStaleMappedFileInfo, prometheus.GaugeValue,
+			1.0, unit.Name, unitType, path)
+	}
+
+	return nil
+}
+
+// staleMappedFiles returns the sorted, de-duplicated paths of deleted files the process is executing or has mapped.
+func staleMappedFiles(p procfs.Proc) ([]string, error) {
+	stale := map[string]struct{}{}
+
+	exe, err := p.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if path, ok := parseDeletedPath(exe); ok {
+		stale[path] = struct{}{}
+	}
+
+	maps, err := p.ProcMaps()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range maps {
+		if path, ok := parseDeletedPath(m.Pathname); ok {
+			stale[path] = struct{}{}
+		}
+	}
+
+	paths := make([]string, 0, len(stale))
+	for path := range stale {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// parseDeletedPath returns the original path of a deleted file, as reported by /proc/X/exe or /proc/X/maps.
+func parseDeletedPath(pathname string) (string, bool) {
+	if !strings.HasPrefix(pathname, "/") || !strings.HasSuffix(pathname, deletedSuffix) {
+		return "", false
+	}
+	path := strings.TrimSuffix(pathname, deletedSuffix)
+	for _, prefix := range staleMappedFileIgnoredPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return "", false
+		}
+	}
+	return path, true
+}
@@ -0,0 +1,97 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// collectSwapMetrics reports the device or file of a swap unit, its priority and activation timeout and, when the
+// swap is active on the exporter's host, its size and usage from /proc/swaps.
+func (c *Collector) collectSwapMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus, scope managerScope) error {
+	swapProperties, err := conn.GetUnitTypeProperties(unit.Name, "Swap")
+	if err != nil {
+		return errors.Wrapf(err, errGetPropertyMsg, "What")
+	}
+	what, ok := swapProperties["What"].(string)
+	if !ok {
+		return errors.Errorf(errConvertStringPropertyMsg, "What", swapProperties["What"])
+	}
+	priority, ok := swapProperties["Priority"].(int32)
+	if !ok {
+		return errors.Errorf(errConvertInt32PropertyMsg, "Priority", swapProperties["Priority"])
+	}
+	timeout, ok := swapProperties["TimeoutUSec"].(uint64)
+	if !ok {
+		return errors.Errorf(errConvertUint64PropertyMsg, "TimeoutUSec", swapProperties["TimeoutUSec"])
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.swapInfo, prometheus.GaugeValue, 1.0,
+		unit.Name, what)
+	ch <- prometheus.MustNewConstMetric(
+		c.swapPriority, prometheus.GaugeValue,
+		float64(priority), unit.Name)
+	ch <- prometheus.MustNewConstMetric(
+		c.swapTimeout, prometheus.GaugeValue,
+		float64(timeout)/1e6, unit.Name)
+
+	if unit.ActiveState != "active" || !scope.sharesHost() {
+		return nil
+	}
+	swaps, err := c.procFS.Swaps()
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read swaps")
+	}
+	swap := findSwap(swaps, what)
+	if swap == nil {
+		return nil
+	}
+	// /proc/swaps reports sizes in KiB
+	ch <- prometheus.MustNewConstMetric(
+		c.swapSizeBytes, prometheus.GaugeValue,
+		float64(swap.Size)*1024, unit.Name)
+	ch <- prometheus.MustNewConstMetric(
+		c.swapUsedBytes, prometheus.GaugeValue,
+		float64(swap.Used)*1024, unit.Name)
+
+	return nil
+}
+
+// findSwap returns the /proc/swaps entry of a swap unit's What. The kernel lists the resolved device, so a What
+// such as /dev/disk/by-uuid/X or /dev/mapper/X is resolved below --path.rootfs if it doesn't match verbatim.
+func findSwap(swaps []*procfs.Swap, what string) *procfs.Swap {
+	candidates := []string{what}
+	if resolved, err := filepath.EvalSymlinks(rootfsFilePath(what)); err == nil {
+		resolved = "/" + strings.TrimPrefix(resolved, filepath.Clean(*rootPath))
+		candidates = append(candidates, filepath.Clean(resolved))
+	}
+	for _, candidate := range candidates {
+		for _, swap := range swaps {
+			// Paths containing whitespace are octal escaped in /proc/swaps
+			if strings.Replace(swap.Filename, `\040`, " ", -1) == candidate {
+				return swap
+			}
+		}
+	}
+	return nil
+}
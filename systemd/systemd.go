@@ -16,9 +16,11 @@
 package systemd
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 
 	// Register pprof-over-http handlers
@@ -41,26 +43,63 @@ import (
 const namespace = "systemd"
 
 var (
-	unitAllowlist             = kingpin.Flag("collector.unit-allowlist", "Regexp of systemd units to allow. Units must both match allowlist and not match blocklist to be included.").Default(".+").String()
-	unitBlocklist             = kingpin.Flag("collector.unit-blocklist", "Regexp of systemd units to block. Units must both match allowlist and not match blocklist to be included.").Default(".+\\.(device)").String()
-	systemdPrivate            = kingpin.Flag("collector.private", "Establish a private, direct connection to systemd without dbus.").Bool()
-	systemdUser               = kingpin.Flag("collector.user", "Connect to the user systemd instance.").Bool()
-	procPath                  = kingpin.Flag("path.procfs", "procfs mountpoint.").Default(procfs.DefaultMountPoint).String()
-	enableRestartsMetrics     = kingpin.Flag("collector.enable-restart-count", "Enables service restart count metrics. This feature only works with systemd 235 and above.").Bool()
-	enableFDMetrics           = kingpin.Flag("collector.enable-file-descriptor-size", "Enables file descriptor size metrics. Systemd Exporter needs access to /proc/X/fd for this to work.").Bool()
-	enableIPAccountingMetrics = kingpin.Flag("collector.enable-ip-accounting", "Enables service ip accounting metrics. This feature only works with systemd 235 and above.").Bool()
-	controlGroupMode          = kingpin.Flag("collector.control-group-mode", "Control group mode").Default(cgroup.Auto.String()).Enum(cgroup.ControlGroupModeStrings()...)
-	controlGroupMountPrefix   = kingpin.Flag("collector.control-group-mount-prefix", "Control group mount prefix").Default("").String()
-	uid                       = kingpin.Flag("collector.uid", "UID when in connecting to the user systemd instance").Default(strconv.Itoa(os.Getuid())).Int()
+	unitAllowlist                 = kingpin.Flag("collector.unit-allowlist", "Regexp of systemd units to allow. Units must both match allowlist and not match blocklist to be included.").Default(".+").String()
+	unitBlocklist                 = kingpin.Flag("collector.unit-blocklist", "Regexp of systemd units to block. Units must both match allowlist and not match blocklist to be included.").Default(".+\\.(device)").String()
+	dependencyUnits               = kingpin.Flag("collector.dependencies.unit-allowlist", "Regexp of systemd units to report Requires, Wants, BindsTo and PartOf dependency metrics for.").Default(".+\\.target").String()
+	probeTargets                  = kingpin.Flag("collector.probe.target-allowlist", "Regexp of the D-Bus socket paths the probe endpoint may connect to, e.g. /var/lib/machines/.+/run/dbus/system_bus_socket.").Default(".+").String()
+	dependencyGraphCacheTTL       = kingpin.Flag("collector.dependency-graph.cache-ttl", "How long the unit dependency graph served over HTTP is reused before it is resolved again.").Default("30s").Duration()
+	systemdPrivate                = kingpin.Flag("collector.private", "Establish a private, direct connection to systemd without dbus.").Bool()
+	systemdUser                   = kingpin.Flag("collector.user", "Connect to the user systemd instance.").Bool()
+	procPath                      = kingpin.Flag("path.procfs", "procfs mountpoint.").Default(procfs.DefaultMountPoint).String()
+	rootPath                      = kingpin.Flag("path.rootfs", "rootfs mountpoint, used to read unit files and other host paths.").Default("/").String()
+	enableRestartsMetrics         = kingpin.Flag("collector.enable-restart-count", "Enables service restart count metrics. This feature only works with systemd 235 and above.").Bool()
+	enableFDMetrics               = kingpin.Flag("collector.enable-file-descriptor-size", "Enables file descriptor size metrics. Systemd Exporter needs access to /proc/X/fd for this to work.").Bool()
+	enableIPAccountingMetrics     = kingpin.Flag("collector.enable-ip-accounting", "Enables service ip accounting metrics. This feature only works with systemd 235 and above.").Bool()
+	enableAllProcessesMetrics     = kingpin.Flag("collector.enable-all-processes", "Enables process metrics summed over every process in the service's control group, exported with scope=\"all\".").Bool()
+	enableSmapsMetrics            = kingpin.Flag("collector.enable-smaps", "Enables unit proportional and unique memory metrics read from /proc/X/smaps_rollup. Reading smaps is expensive, see --collector.smaps.max-concurrency.").Bool()
+	smapsMaxConcurrency           = kingpin.Flag("collector.smaps.max-concurrency", "Maximum number of /proc/X/smaps_rollup files read in parallel.").Default("4").Int()
+	enableProcessIOMetrics        = kingpin.Flag("collector.enable-process-io", "Enables unit io metrics summed from /proc/X/io of every process in the unit's control group. Systemd Exporter needs access to /proc/X/io for this to work.").Bool()
+	enableProcessStateMetrics     = kingpin.Flag("collector.enable-process-state", "Enables service process state, thread and context switch metrics. Systemd Exporter needs access to /proc/X/stat and /proc/X/task for this to work.").Bool()
+	enableFDTypeMetrics           = kingpin.Flag("collector.enable-file-descriptor-types", "Enables service file descriptor metrics by type, counted over every process in the service's control group. Systemd Exporter needs access to /proc/X/fd for this to work.").Bool()
+	enableLimitMetrics            = kingpin.Flag("collector.enable-process-limits", "Enables soft and hard resource limit metrics of the service's main process and unit. Systemd Exporter needs access to /proc/X/limits for this to work.").Bool()
+	enableUnitSocketMetrics       = kingpin.Flag("collector.enable-unit-sockets", "Enables service TCP and UDP socket metrics by state. Systemd Exporter needs access to /proc/X/fd and /proc/X/net for this to work.").Bool()
+	enableListenQueueMetrics      = kingpin.Flag("collector.enable-socket-listen-queue", "Enables socket unit accept queue metrics. Systemd Exporter needs access to /proc/1/net for this to work.").Bool()
+	enableKubernetesMetrics       = kingpin.Flag("collector.enable-kubernetes", "Enables systemd_unit_kubernetes_info with the QoS class, pod UID and container ID of kubelet's kubepods slices and container scopes.").Bool()
+	managers                      = kingpin.Flag("collector.manager", "Systemd manager to collect, labelled with manager and uid. One of system, private (the system manager through /run/systemd/private), user (the user manager of --collector.uid) or user@<uid>. May be repeated to collect several managers concurrently. Overrides --collector.private and --collector.user.").Strings()
+	enableUserManagers            = kingpin.Flag("collector.enable-user-managers", "Additionally collect the units of every user's systemd instance reachable through /run/user/<uid>/systemd/private below --path.rootfs, labelled with manager=\"user\" and their uid.").Bool()
+	enableLogindMetrics           = kingpin.Flag("collector.enable-logind", "Enables metrics about the sessions, users and seats of systemd-logind, read over the system bus.").Bool()
+	enableContainerMetrics        = kingpin.Flag("collector.enable-containers", "Enables systemd_unit_container_info with the ID, name and image of Docker and Podman container scopes.").Bool()
+	dockerRoot                    = kingpin.Flag("collector.containers.docker-root", "Docker root directory to read container names and images from, relative to --path.rootfs.").Default("/var/lib/docker").String()
+	podmanRoot                    = kingpin.Flag("collector.containers.podman-root", "Podman containers/storage root directory to read container names and images from, relative to --path.rootfs.").Default("/var/lib/containers/storage").String()
+	enableInvocationIDMetrics     = kingpin.Flag("collector.enable-invocation-id", "Enables systemd_unit_invocation_info with the current invocation ID of units, as used by journalctl _SYSTEMD_INVOCATION_ID=.").Bool()
+	enableUnitFileLabels          = kingpin.Flag("collector.enable-unit-file-labels", "Enables systemd_unit_labels with the X-Prometheus-Label-<name>=<value> keys of the [Unit] section of unit files. Unit files are read relative to --path.rootfs.").Bool()
+	unitFileLabelsLimit           = kingpin.Flag("collector.unit-file-labels.limit", "Maximum number of unit file labels per unit, further labels are dropped.").Default("10").Int()
+	enableSliceTotalsMetrics      = kingpin.Flag("collector.enable-slice-totals", "Enables memory and task totals of slices, including all units and slices below them.").Bool()
+	enableMountFilesystemMetrics  = kingpin.Flag("collector.enable-mount-filesystem", "Enables filesystem size and inode metrics of active mount units. Mount points are read relative to --path.rootfs.").Bool()
+	mountStatfsTimeout            = kingpin.Flag("collector.mount.statfs-timeout", "Timeout of statfs calls on mount points, mount points which time out are skipped until the call returns.").Default("5s").Duration()
+	enableStaleMappedFilesMetrics = kingpin.Flag("collector.enable-stale-mapped-files", "Enables metrics about deleted executables and libraries still mapped by services. Systemd Exporter needs access to /proc/X/exe and /proc/X/maps for this to work.").Bool()
+	staleMappedFilesAllProcesses  = kingpin.Flag("collector.stale-mapped-files.all-processes", "Inspect every process in the service's control group instead of only MainPID for --collector.enable-stale-mapped-files.").Bool()
+	controlGroupMode              = kingpin.Flag("collector.control-group-mode", "Control group mode").Default(cgroup.Auto.String()).Enum(cgroup.ControlGroupModeStrings()...)
+	controlGroupMountPrefix       = kingpin.Flag("collector.control-group-mount-prefix", "Control group mount prefix").Default("").String()
+	uid                           = kingpin.Flag("collector.uid", "UID when in connecting to the user systemd instance").Default(strconv.Itoa(os.Getuid())).Int()
 )
 
 var unitStatesName = []string{"active", "activating", "deactivating", "inactive", "failed"}
 
+// Values of the scope label on process metrics
+const (
+	processScopeMain = "main"
+	processScopeAll  = "all"
+)
+
 var (
 	errGetPropertyMsg           = "couldn't get unit's %s property"
 	errConvertUint64PropertyMsg = "couldn't convert unit's %s property %v to uint64"
 	errConvertUint32PropertyMsg = "couldn't convert unit's %s property %v to uint32"
 	errConvertStringPropertyMsg = "couldn't convert unit's %s property %v to string"
+	errConvertInt32PropertyMsg  = "couldn't convert unit's %s property %v to int32"
+	errConvertBoolPropertyMsg   = "couldn't convert unit's %s property %v to bool"
+	errConvertArrayPropertyMsg  = "couldn't convert unit's %s property %v to array"
 	errUnitMetricsMsg           = "couldn't get unit's metrics: %s"
 	errControlGroupReadMsg      = "failed to read %s from control group"
 	infoUnitNoHandler           = "no unit type handler for %s"
@@ -71,17 +110,25 @@ type Collector struct {
 
 	controlGroupMode        cgroup.ControlGroupMode
 	controlGroupMountPrefix string
+	procFS                  procfs.FS
+	procPath                string
 
 	unitState                     *prometheus.Desc
 	unitInfo                      *prometheus.Desc
 	unitStartTimeDesc             *prometheus.Desc
 	unitTasksCurrentDesc          *prometheus.Desc
 	unitTasksMaxDesc              *prometheus.Desc
+	unitNeedsDaemonReloadDesc     *prometheus.Desc
+	unitConfigNewerThanStartDesc  *prometheus.Desc
 	nRestartsDesc                 *prometheus.Desc
 	timerLastTriggerDesc          *prometheus.Desc
 	socketAcceptedConnectionsDesc *prometheus.Desc
 	socketCurrentConnectionsDesc  *prometheus.Desc
 	socketRefusedConnectionsDesc  *prometheus.Desc
+	socketListenInfo              *prometheus.Desc
+	socketBacklog                 *prometheus.Desc
+	socketMaxConnections          *prometheus.Desc
+	socketListenQueue             *prometheus.Desc
 	cpuTotalDesc                  *prometheus.Desc
 	unitCPUTotal                  *prometheus.Desc
 
@@ -92,6 +139,10 @@ type Collector struct {
 
 	openFDs          *prometheus.Desc
 	maxFDs           *prometheus.Desc
+	fdUtilization    *prometheus.Desc
+	unitOpenFDs      *prometheus.Desc
+	processLimit     *prometheus.Desc
+	serviceLimit     *prometheus.Desc
 	vsize            *prometheus.Desc
 	maxVsize         *prometheus.Desc
 	rss              *prometheus.Desc
@@ -100,8 +151,77 @@ type Collector struct {
 	ipIngressPackets *prometheus.Desc
 	ipEgressPackets  *prometheus.Desc
 
+	unitStaleMappedFiles    *prometheus.Desc
+	unitStaleMappedFileInfo *prometheus.Desc
+
+	unitMemPss     *prometheus.Desc
+	unitMemUss     *prometheus.Desc
+	unitMemSwapPss *prometheus.Desc
+	smapsSemaphore chan struct{}
+
+	unitIOReadChars           *prometheus.Desc
+	unitIOWriteChars          *prometheus.Desc
+	unitIOReadSyscalls        *prometheus.Desc
+	unitIOWriteSyscalls       *prometheus.Desc
+	unitIOReadBytes           *prometheus.Desc
+	unitIOWriteBytes          *prometheus.Desc
+	unitIOCancelledWriteBytes *prometheus.Desc
+
+	unitProcesses       *prometheus.Desc
+	unitThreads         *prometheus.Desc
+	unitContextSwitches *prometheus.Desc
+
+	unitSockets           *prometheus.Desc
+	unitSocketListenQueue *prometheus.Desc
+
+	mountInfo       *prometheus.Desc
+	mountSizeBytes  *prometheus.Desc
+	mountFreeBytes  *prometheus.Desc
+	mountAvailBytes *prometheus.Desc
+	mountFiles      *prometheus.Desc
+	mountFilesFree  *prometheus.Desc
+	statfsCalls     map[string]*statfsCall
+	statfsCallsMtx  sync.Mutex
+
+	dependencyGraphs   map[string]cachedDependencyGraph
+	dependencyGraphMtx sync.Mutex
+
+	swapInfo      *prometheus.Desc
+	swapPriority  *prometheus.Desc
+	swapTimeout   *prometheus.Desc
+	swapSizeBytes *prometheus.Desc
+	swapUsedBytes *prometheus.Desc
+
+	automountInfo          *prometheus.Desc
+	automountDirectoryMode *prometheus.Desc
+	automountTimeoutIdle   *prometheus.Desc
+	automountMounted       *prometheus.Desc
+	pathInfo               *prometheus.Desc
+	pathResult             *prometheus.Desc
+	pathLastTrigger        *prometheus.Desc
+
+	unitDependencies      *prometheus.Desc
+	unitDependenciesUnmet *prometheus.Desc
+
+	sliceCPUTotal    *prometheus.Desc
+	sliceMemoryBytes *prometheus.Desc
+	sliceTasks       *prometheus.Desc
+
+	unitInvocationInfo *prometheus.Desc
+	unitKubernetesInfo *prometheus.Desc
+	unitContainerInfo  *prometheus.Desc
+	podmanContainers   podmanContainers
+
+	logind *logindCollector
+
+	managerTargets        []managerTarget
+	managerScrapeSuccess  *prometheus.Desc
+	managerScrapeDuration *prometheus.Desc
+
 	unitWhitelistPattern *regexp.Regexp
 	unitBlacklistPattern *regexp.Regexp
+	dependencyPattern    *regexp.Regexp
+	probeTargetPattern   *regexp.Regexp
 }
 
 // NewCollector returns a new Collector exposing systemd statistics.
@@ -126,7 +246,7 @@ func NewCollector(logger log.Logger) (*Collector, error) {
 	unitInfo := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "unit_info"),
 		"Mostly-static metadata for all unit types",
-		[]string{"name", "type", "mount_type", "service_type"}, nil,
+		[]string{"name", "type", "mount_type", "service_type", "template", "instance", "slice", "description"}, nil,
 	)
 	unitStartTimeDesc := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "unit_start_time_seconds"),
@@ -143,6 +263,16 @@ func NewCollector(logger log.Logger) (*Collector, error) {
 		"Maximum number of tasks per Systemd unit",
 		[]string{"name", "type"}, nil,
 	)
+	unitNeedsDaemonReloadDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_needs_daemon_reload"),
+		"Whether the unit file changed on disk and systemd needs a daemon-reload to pick it up",
+		[]string{"name", "type"}, nil,
+	)
+	unitConfigNewerThanStartDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_config_newer_than_start"),
+		"Whether the unit file or one of its drop-ins was modified after the unit last became active",
+		[]string{"name", "type"}, nil,
+	)
 	nRestartsDesc := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "service_restart_total"),
 		"Service unit count of Restart triggers", []string{"name"}, nil)
@@ -158,11 +288,23 @@ func NewCollector(logger log.Logger) (*Collector, error) {
 	socketRefusedConnectionsDesc := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "socket_refused_connections_total"),
 		"Total number of refused socket connections", []string{"name"}, nil)
+	socketListenInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "socket_listen_info"),
+		"Address a socket unit listens on", []string{"name", "type", "address"}, nil)
+	socketBacklog := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "socket_backlog"),
+		"Configured listen backlog of the socket unit", []string{"name"}, nil)
+	socketMaxConnections := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "socket_max_connections"),
+		"Configured maximum number of concurrent connections of the socket unit", []string{"name"}, nil)
+	socketListenQueue := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "socket_listen_queue_length"),
+		"Number of connections waiting to be accepted on a listening address of the socket unit", []string{"name", "address"}, nil)
 
 	cpuTotalDesc := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "process_cpu_seconds_total"),
 		"Total user and system CPU time spent in seconds.",
-		[]string{"name"}, nil,
+		[]string{"name", "scope"}, nil,
 	)
 	// We could add a cpu label, but IMO that could cause a cardinality explosion. We already export
 	// two modes per unit (user/system), and on a modest 4 core machine adding a cpu label would cause us to export 8 metics
@@ -197,30 +339,50 @@ func NewCollector(logger log.Logger) (*Collector, error) {
 	openFDs := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "process_open_fds"),
 		"Number of open file descriptors.",
-		[]string{"name"}, nil,
+		[]string{"name", "scope"}, nil,
 	)
 
 	maxFDs := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "process_max_fds"),
 		"Maximum number of open file descriptors.",
-		[]string{"name"}, nil,
+		[]string{"name", "scope"}, nil,
+	)
+	fdUtilization := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "process_fd_utilization_ratio"),
+		"Ratio of open file descriptors to the maximum number of open file descriptors. For scope=\"all\" the highest ratio of any process.",
+		[]string{"name", "scope"}, nil,
+	)
+	unitOpenFDs := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_open_fds"),
+		"Number of open file descriptors of the unit's processes by type.",
+		[]string{"name", "type", "fd_type"}, nil,
+	)
+	processLimit := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "process_limit"),
+		"Resource limit of the service's main process, as reported by /proc/X/limits.",
+		[]string{"name", "resource", "kind"}, nil,
+	)
+	serviceLimit := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "service_limit"),
+		"Resource limit configured on the service unit, e.g. LimitNOFILE=.",
+		[]string{"name", "resource", "kind"}, nil,
 	)
 	vsize := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "process_virtual_memory_bytes"),
 		"Virtual memory size in bytes.",
-		[]string{"name"}, nil,
+		[]string{"name", "scope"}, nil,
 	)
 
 	maxVsize := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "process_virtual_memory_max_bytes"),
 		"Maximum amount of virtual memory available in bytes.",
-		[]string{"name"}, nil,
+		[]string{"name", "scope"}, nil,
 	)
 
 	rss := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "process_resident_memory_bytes"),
 		"Resident memory size in bytes.",
-		[]string{"name"}, nil,
+		[]string{"name", "scope"}, nil,
 	)
 
 	ipIngressBytes := prometheus.NewDesc(
@@ -243,28 +405,284 @@ func NewCollector(logger log.Logger) (*Collector, error) {
 		"Service unit egress IP accounting in packets.",
 		[]string{"name"}, nil,
 	)
+	unitStaleMappedFiles := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_stale_mapped_files"),
+		"Number of deleted executables and libraries still mapped by the unit's processes.",
+		[]string{"name", "type"}, nil,
+	)
+	unitStaleMappedFileInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_stale_mapped_file_info"),
+		"Deleted executable or library still mapped by the unit's processes.",
+		[]string{"name", "type", "path"}, nil,
+	)
+	unitMemPss := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_memory_pss_bytes"),
+		"Unit proportional set size, shared pages are divided between the processes mapping them",
+		[]string{"name", "type"}, nil,
+	)
+	unitMemUss := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_memory_uss_bytes"),
+		"Unit unique set size, pages which are private to the unit's processes",
+		[]string{"name", "type"}, nil,
+	)
+	unitMemSwapPss := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_memory_swap_pss_bytes"),
+		"Unit proportional swap usage",
+		[]string{"name", "type"}, nil,
+	)
+	unitIOReadChars := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_process_io_read_chars"),
+		"Characters read by the unit's current processes, including from the page cache and pipes (rchar)",
+		[]string{"name", "type"}, nil,
+	)
+	unitIOWriteChars := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_process_io_write_chars"),
+		"Characters written by the unit's current processes, including to the page cache and pipes (wchar)",
+		[]string{"name", "type"}, nil,
+	)
+	unitIOReadSyscalls := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_process_io_read_syscalls"),
+		"Read syscalls made by the unit's current processes (syscr)",
+		[]string{"name", "type"}, nil,
+	)
+	unitIOWriteSyscalls := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_process_io_write_syscalls"),
+		"Write syscalls made by the unit's current processes (syscw)",
+		[]string{"name", "type"}, nil,
+	)
+	unitIOReadBytes := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_process_io_read_bytes"),
+		"Bytes the unit's current processes caused to be fetched from the storage layer (read_bytes)",
+		[]string{"name", "type"}, nil,
+	)
+	unitIOWriteBytes := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_process_io_write_bytes"),
+		"Bytes the unit's current processes caused to be sent to the storage layer (write_bytes)",
+		[]string{"name", "type"}, nil,
+	)
+	unitIOCancelledWriteBytes := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_process_io_cancelled_write_bytes"),
+		"Bytes the unit's current processes caused to not be written, e.g. by truncating dirty page cache (cancelled_write_bytes)",
+		[]string{"name", "type"}, nil,
+	)
+	unitProcesses := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_processes"),
+		"Number of the unit's processes by scheduler state (R running, S sleeping, D uninterruptible sleep, Z zombie, T stopped)",
+		[]string{"name", "type", "state"}, nil,
+	)
+	unitThreads := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_threads"),
+		"Number of threads of the unit's processes",
+		[]string{"name", "type"}, nil,
+	)
+	unitContextSwitches := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_context_switches"),
+		"Context switches of the unit's current threads",
+		[]string{"name", "type", "ctxswitch"}, nil,
+	)
+	unitSockets := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_sockets"),
+		"Number of TCP and UDP sockets held open by the unit's processes by state",
+		[]string{"name", "protocol", "state"}, nil,
+	)
+	unitSocketListenQueue := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_socket_listen_queue_length"),
+		"Number of connections waiting to be accepted on the unit's listening sockets",
+		[]string{"name", "protocol"}, nil,
+	)
+	mountInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "mount_info"),
+		"What and where a mount unit mounts, with its mount options",
+		[]string{"name", "what", "where", "options"}, nil,
+	)
+	mountSizeBytes := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "mount_size_bytes"),
+		"Filesystem size of the mount unit in bytes",
+		[]string{"name"}, nil,
+	)
+	mountFreeBytes := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "mount_free_bytes"),
+		"Filesystem free space of the mount unit in bytes",
+		[]string{"name"}, nil,
+	)
+	mountAvailBytes := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "mount_avail_bytes"),
+		"Filesystem space available to non-root users of the mount unit in bytes",
+		[]string{"name"}, nil,
+	)
+	mountFiles := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "mount_files"),
+		"Filesystem total file nodes of the mount unit",
+		[]string{"name"}, nil,
+	)
+	mountFilesFree := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "mount_files_free"),
+		"Filesystem free file nodes of the mount unit",
+		[]string{"name"}, nil,
+	)
+	swapInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "swap_info"),
+		"Device or file backing a swap unit",
+		[]string{"name", "what"}, nil,
+	)
+	swapPriority := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "swap_priority"),
+		"Priority of the swap unit",
+		[]string{"name"}, nil,
+	)
+	swapTimeout := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "swap_timeout_seconds"),
+		"Time to wait for the swapon command to finish",
+		[]string{"name"}, nil,
+	)
+	swapSizeBytes := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "swap_size_bytes"),
+		"Size of the active swap unit in bytes",
+		[]string{"name"}, nil,
+	)
+	swapUsedBytes := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "swap_used_bytes"),
+		"Used space of the active swap unit in bytes",
+		[]string{"name"}, nil,
+	)
+	automountInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "automount_info"),
+		"Mount point of an automount unit",
+		[]string{"name", "where"}, nil,
+	)
+	automountDirectoryMode := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "automount_directory_mode"),
+		"File system access mode of directories created by the automount unit",
+		[]string{"name"}, nil,
+	)
+	automountTimeoutIdle := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "automount_timeout_idle_seconds"),
+		"Idle time after which the automount unit unmounts its mount point, 0 if disabled",
+		[]string{"name"}, nil,
+	)
+	automountMounted := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "automount_mounted"),
+		"Whether the mount unit backing the automount unit is active",
+		[]string{"name", "mount"}, nil,
+	)
+	pathInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "path_info"),
+		"Path watched by a path unit",
+		[]string{"name", "type", "path"}, nil,
+	)
+	pathResult := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "path_result"),
+		"Result of the path unit",
+		[]string{"name", "result"}, nil,
+	)
+	pathLastTrigger := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "path_last_trigger_timestamp_seconds"),
+		"Time the unit activated by the path unit last left the inactive state, 0 if never",
+		[]string{"name", "unit"}, nil,
+	)
+	unitDependencies := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_dependencies"),
+		"Number of dependencies of the unit by kind",
+		[]string{"name", "kind"}, nil,
+	)
+	unitDependenciesUnmet := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_dependencies_unmet"),
+		"Number of dependencies of the unit which are failed, or for Requires and BindsTo, not active",
+		[]string{"name", "kind"}, nil,
+	)
+	sliceCPUTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "slice_cpu_seconds_total"),
+		"Seconds of CPU time used by the slice including all units and slices below it",
+		[]string{"name", "mode"}, nil,
+	)
+	sliceMemoryBytes := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "slice_memory_bytes"),
+		"Memory usage of the slice including all units and slices below it",
+		[]string{"name"}, nil,
+	)
+	sliceTasks := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "slice_tasks"),
+		"Number of tasks of the slice including all units and slices below it",
+		[]string{"name"}, nil,
+	)
+	unitInvocationInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_invocation_info"),
+		"Current invocation ID of the unit",
+		[]string{"name", "invocation_id"}, nil,
+	)
+	unitKubernetesInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_kubernetes_info"),
+		"Kubernetes QoS class, pod UID and container ID of a kubelet slice or scope",
+		[]string{"name", "qos_class", "pod_uid", "container_id"}, nil,
+	)
+	unitContainerInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_container_info"),
+		"Container runtime, ID, name and image of a container scope",
+		[]string{"name", "runtime", "container_id", "container_name", "image"}, nil,
+	)
+	if *smapsMaxConcurrency < 1 {
+		return nil, errors.Errorf("--collector.smaps.max-concurrency must be at least 1, got %d", *smapsMaxConcurrency)
+	}
+	if *unitFileLabelsLimit < 0 {
+		return nil, errors.Errorf("--collector.unit-file-labels.limit must not be negative, got %d", *unitFileLabelsLimit)
+	}
 	unitWhitelistPattern := regexp.MustCompile(fmt.Sprintf("^(?:%s)$", *unitAllowlist))
 	unitBlacklistPattern := regexp.MustCompile(fmt.Sprintf("^(?:%s)$", *unitBlocklist))
+	dependencyPattern := regexp.MustCompile(fmt.Sprintf("^(?:%s)$", *dependencyUnits))
+	probeTargetPattern := regexp.MustCompile(fmt.Sprintf("^(?:%s)$", *probeTargets))
+
+	managerScrapeSuccess := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "manager_scrape_success"),
+		"Whether collecting the units of the systemd manager succeeded",
+		nil, nil,
+	)
+	managerScrapeDuration := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "manager_scrape_duration_seconds"),
+		"Time it took to collect the units of the systemd manager",
+		nil, nil,
+	)
+	managerTargets, err := newManagerTargets(*managers)
+	if err != nil {
+		return nil, err
+	}
+
+	var logind *logindCollector
+	if *enableLogindMetrics {
+		logind = newLogindCollector(logger)
+	}
 
 	mode, err := cgroup.ControlGroupModeString(*controlGroupMode)
 	if err != nil {
 		return nil, err
 	}
 
+	procFS, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't open procfs")
+	}
+
 	return &Collector{
 		controlGroupMode:              mode,
 		controlGroupMountPrefix:       *controlGroupMountPrefix,
+		procFS:                        procFS,
+		procPath:                      *procPath,
 		logger:                        logger,
 		unitState:                     unitState,
 		unitInfo:                      unitInfo,
 		unitStartTimeDesc:             unitStartTimeDesc,
 		unitTasksCurrentDesc:          unitTasksCurrentDesc,
 		unitTasksMaxDesc:              unitTasksMaxDesc,
+		unitNeedsDaemonReloadDesc:     unitNeedsDaemonReloadDesc,
+		unitConfigNewerThanStartDesc:  unitConfigNewerThanStartDesc,
 		nRestartsDesc:                 nRestartsDesc,
 		timerLastTriggerDesc:          timerLastTriggerDesc,
 		socketAcceptedConnectionsDesc: socketAcceptedConnectionsDesc,
 		socketCurrentConnectionsDesc:  socketCurrentConnectionsDesc,
 		socketRefusedConnectionsDesc:  socketRefusedConnectionsDesc,
+		socketListenInfo:              socketListenInfo,
+		socketBacklog:                 socketBacklog,
+		socketMaxConnections:          socketMaxConnections,
+		socketListenQueue:             socketListenQueue,
 		cpuTotalDesc:                  cpuTotalDesc,
 		unitCPUTotal:                  unitCPUTotal,
 		unitMemCache:                  unitMemCache,
@@ -273,6 +691,10 @@ func NewCollector(logger log.Logger) (*Collector, error) {
 		unitMemShmem:                  unitMemShmem,
 		openFDs:                       openFDs,
 		maxFDs:                        maxFDs,
+		fdUtilization:                 fdUtilization,
+		unitOpenFDs:                   unitOpenFDs,
+		processLimit:                  processLimit,
+		serviceLimit:                  serviceLimit,
 		vsize:                         vsize,
 		maxVsize:                      maxVsize,
 		rss:                           rss,
@@ -280,8 +702,59 @@ func NewCollector(logger log.Logger) (*Collector, error) {
 		ipEgressBytes:                 ipEgressBytes,
 		ipIngressPackets:              ipIngressPackets,
 		ipEgressPackets:               ipEgressPackets,
+		unitStaleMappedFiles:          unitStaleMappedFiles,
+		unitStaleMappedFileInfo:       unitStaleMappedFileInfo,
+		unitMemPss:                    unitMemPss,
+		unitMemUss:                    unitMemUss,
+		unitMemSwapPss:                unitMemSwapPss,
+		smapsSemaphore:                make(chan struct{}, *smapsMaxConcurrency),
+		unitIOReadChars:               unitIOReadChars,
+		unitIOWriteChars:              unitIOWriteChars,
+		unitIOReadSyscalls:            unitIOReadSyscalls,
+		unitIOWriteSyscalls:           unitIOWriteSyscalls,
+		unitIOReadBytes:               unitIOReadBytes,
+		unitIOWriteBytes:              unitIOWriteBytes,
+		unitIOCancelledWriteBytes:     unitIOCancelledWriteBytes,
+		unitProcesses:                 unitProcesses,
+		unitThreads:                   unitThreads,
+		unitContextSwitches:           unitContextSwitches,
+		unitSockets:                   unitSockets,
+		unitSocketListenQueue:         unitSocketListenQueue,
+		mountInfo:                     mountInfo,
+		mountSizeBytes:                mountSizeBytes,
+		mountFreeBytes:                mountFreeBytes,
+		mountAvailBytes:               mountAvailBytes,
+		mountFiles:                    mountFiles,
+		mountFilesFree:                mountFilesFree,
+		statfsCalls:                   map[string]*statfsCall{},
+		swapInfo:                      swapInfo,
+		swapPriority:                  swapPriority,
+		swapTimeout:                   swapTimeout,
+		swapSizeBytes:                 swapSizeBytes,
+		swapUsedBytes:                 swapUsedBytes,
+		automountInfo:                 automountInfo,
+		automountDirectoryMode:        automountDirectoryMode,
+		automountTimeoutIdle:          automountTimeoutIdle,
+		automountMounted:              automountMounted,
+		pathInfo:                      pathInfo,
+		pathResult:                    pathResult,
+		pathLastTrigger:               pathLastTrigger,
+		unitDependencies:              unitDependencies,
+		unitDependenciesUnmet:         unitDependenciesUnmet,
+		sliceCPUTotal:                 sliceCPUTotal,
+		sliceMemoryBytes:              sliceMemoryBytes,
+		sliceTasks:                    sliceTasks,
+		unitInvocationInfo:            unitInvocationInfo,
+		unitKubernetesInfo:            unitKubernetesInfo,
+		unitContainerInfo:             unitContainerInfo,
+		logind:                        logind,
+		managerTargets:                managerTargets,
+		managerScrapeSuccess:          managerScrapeSuccess,
+		managerScrapeDuration:         managerScrapeDuration,
 		unitWhitelistPattern:          unitWhitelistPattern,
 		unitBlacklistPattern:          unitBlacklistPattern,
+		dependencyPattern:             dependencyPattern,
+		probeTargetPattern:            probeTargetPattern,
 	}, nil
 }
 
@@ -291,6 +764,12 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	if err != nil {
 		c.logger.Error(err)
 	}
+	if c.logind != nil {
+		err = c.logind.collect(ch)
+		if err != nil {
+			c.logger.Error(err)
+		}
+	}
 }
 
 // Describe gathers descriptions of Metrics
@@ -300,14 +779,24 @@ func (c *Collector) Describe(desc chan<- *prometheus.Desc) {
 	desc <- c.unitStartTimeDesc
 	desc <- c.unitTasksCurrentDesc
 	desc <- c.unitTasksMaxDesc
+	desc <- c.unitNeedsDaemonReloadDesc
+	desc <- c.unitConfigNewerThanStartDesc
 	desc <- c.nRestartsDesc
 	desc <- c.timerLastTriggerDesc
 	desc <- c.socketAcceptedConnectionsDesc
 	desc <- c.socketCurrentConnectionsDesc
 	desc <- c.socketRefusedConnectionsDesc
+	desc <- c.socketListenInfo
+	desc <- c.socketBacklog
+	desc <- c.socketMaxConnections
+	desc <- c.socketListenQueue
 	desc <- c.cpuTotalDesc
 	desc <- c.openFDs
 	desc <- c.maxFDs
+	desc <- c.fdUtilization
+	desc <- c.unitOpenFDs
+	desc <- c.processLimit
+	desc <- c.serviceLimit
 	desc <- c.vsize
 	desc <- c.maxVsize
 	desc <- c.rss
@@ -315,7 +804,54 @@ func (c *Collector) Describe(desc chan<- *prometheus.Desc) {
 	desc <- c.ipEgressBytes
 	desc <- c.ipIngressPackets
 	desc <- c.ipEgressPackets
-
+	desc <- c.unitStaleMappedFiles
+	desc <- c.unitStaleMappedFileInfo
+	desc <- c.unitMemPss
+	desc <- c.unitMemUss
+	desc <- c.unitMemSwapPss
+	desc <- c.unitIOReadChars
+	desc <- c.unitIOWriteChars
+	desc <- c.unitIOReadSyscalls
+	desc <- c.unitIOWriteSyscalls
+	desc <- c.unitIOReadBytes
+	desc <- c.unitIOWriteBytes
+	desc <- c.unitIOCancelledWriteBytes
+	desc <- c.unitProcesses
+	desc <- c.unitThreads
+	desc <- c.unitContextSwitches
+	desc <- c.unitSockets
+	desc <- c.unitSocketListenQueue
+	desc <- c.mountInfo
+	desc <- c.mountSizeBytes
+	desc <- c.mountFreeBytes
+	desc <- c.mountAvailBytes
+	desc <- c.mountFiles
+	desc <- c.mountFilesFree
+	desc <- c.swapInfo
+	desc <- c.swapPriority
+	desc <- c.swapTimeout
+	desc <- c.swapSizeBytes
+	desc <- c.swapUsedBytes
+	desc <- c.automountInfo
+	desc <- c.automountDirectoryMode
+	desc <- c.automountTimeoutIdle
+	desc <- c.automountMounted
+	desc <- c.pathInfo
+	desc <- c.pathResult
+	desc <- c.pathLastTrigger
+	desc <- c.unitDependencies
+	desc <- c.unitDependenciesUnmet
+	desc <- c.sliceCPUTotal
+	desc <- c.sliceMemoryBytes
+	desc <- c.sliceTasks
+	desc <- c.unitInvocationInfo
+	desc <- c.unitKubernetesInfo
+	desc <- c.unitContainerInfo
+	desc <- c.managerScrapeSuccess
+	desc <- c.managerScrapeDuration
+	if c.logind != nil {
+		c.logind.describe(desc)
+	}
 }
 
 func parseUnitType(unit dbus.UnitStatus) string {
@@ -331,13 +867,34 @@ func parseUnitTypeInterface(unit dbus.UnitStatus) string {
 }
 
 func (c *Collector) collect(ch chan<- prometheus.Metric) error {
-	begin := time.Now()
-	conn, err := c.newDbus()
-	if err != nil {
-		return errors.Wrapf(err, "couldn't get dbus connection")
+	targets := c.managerTargets
+	if *enableUserManagers {
+		userTargets, err := c.userManagerTargets()
+		if err != nil {
+			c.logger.Warnf("couldn't find user managers: %s", err)
+		}
+		targets = append(targets[:len(targets):len(targets)], userTargets...)
 	}
-	defer conn.Close()
 
+	var wg sync.WaitGroup
+	wg.Add(len(targets))
+	for _, target := range targets {
+		go func(target managerTarget) {
+			err := c.collectManagerTarget(ch, target)
+			if err != nil {
+				c.logger.Errorf("couldn't collect systemd manager %s: %s", target.name, err)
+			}
+			wg.Done()
+		}(target)
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// collectManager collects the units of the systemd instance conn is connected to.
+func (c *Collector) collectManager(conn *dbus.Conn, ch chan<- prometheus.Metric, scope managerScope) error {
+	begin := time.Now()
 	allUnits, err := conn.ListUnits()
 	if err != nil {
 		return errors.Wrap(err, "could not get list of systemd units from dbus")
@@ -347,12 +904,13 @@ func (c *Collector) collect(ch chan<- prometheus.Metric) error {
 	begin = time.Now()
 	units := filterUnits(allUnits, c.unitWhitelistPattern, c.unitBlacklistPattern)
 	c.logger.Debugf("systemd filterUnits took %f", time.Since(begin).Seconds())
+	activeStates := unitActiveStates(allUnits)
 
 	var wg sync.WaitGroup
 	wg.Add(len(units))
 	for _, unit := range units {
 		go func(unit dbus.UnitStatus) {
-			err := c.collectUnit(conn, ch, unit)
+			err := c.collectUnit(conn, ch, unit, activeStates, scope)
 			if err != nil {
 				c.logger.Warnf(errUnitMetricsMsg, err)
 			}
@@ -364,7 +922,7 @@ func (c *Collector) collect(ch chan<- prometheus.Metric) error {
 	return nil
 }
 
-func (c *Collector) collectUnit(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus) error {
+func (c *Collector) collectUnit(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus, activeStates map[string]string, scope managerScope) error {
 	logger := c.logger.With("unit", unit.Name)
 
 	// Collect unit_state for all unit types
@@ -374,10 +932,44 @@ func (c *Collector) collectUnit(conn *dbus.Conn, ch chan<- prometheus.Metric, un
 		// TODO should we continue processing here?
 	}
 
+	// The properties of the Unit interface are fetched in one call instead of one call per property
+	unitProperties, err := conn.GetUnitProperties(unit.Name)
+	if err != nil {
+		logger.Warnf(errUnitMetricsMsg, errors.Wrap(err, "couldn't get unit's properties"))
+	} else {
+		err = c.collectUnitConfigMetrics(ch, unit, unitProperties, scope)
+		if err != nil {
+			logger.Warnf(errUnitMetricsMsg, err)
+		}
+		if *enableUnitFileLabels && scope.sharesHost() {
+			err = c.collectUnitFileLabels(ch, unit, unitProperties)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
+		}
+		if *enableInvocationIDMetrics {
+			err = c.collectUnitInvocationID(ch, unit, unitProperties)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
+		}
+		if c.dependencyPattern.MatchString(unit.Name) {
+			err = c.collectUnitDependencyMetrics(ch, unit, unitProperties, activeStates)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
+		}
+	}
+
 	// Collect metrics from cgroups
+	var cgroupPath *string
 	switch parseUnitType(unit) {
 	case "service", "mount", "socket", "swap", "slice":
-		cgroupPath, err := c.getControlGroup(conn, unit)
+		// The cgroups of other hosts' units aren't below the exporter's cgroupfs
+		if !scope.sharesHost() {
+			break
+		}
+		cgroupPath, err = c.getControlGroup(conn, unit)
 		if err != nil {
 			remainAfterExitProperty, getUnitErr := conn.GetUnitTypeProperty(unit.Name, "Service", "RemainAfterExit")
 			remainAfterExit, ok := remainAfterExitProperty.Value.Value().(bool)
@@ -401,6 +993,28 @@ func (c *Collector) collectUnit(conn *dbus.Conn, ch chan<- prometheus.Metric, un
 		if err != nil {
 			logger.Warnf(errUnitMetricsMsg, err)
 		}
+		// Slices would re-read the procfs files of every process of their descendants
+		if parseUnitType(unit) == "slice" {
+			if *enableSliceTotalsMetrics {
+				err = c.collectSliceMetrics(*cgroupPath, ch, unit)
+				if err != nil {
+					logger.Warnf(errUnitMetricsMsg, err)
+				}
+			}
+			break
+		}
+		if *enableSmapsMetrics {
+			err = c.collectUnitSmapsMetrics(*cgroupPath, ch, unit)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
+		}
+		if *enableProcessIOMetrics {
+			err = c.collectUnitProcessIOMetrics(*cgroupPath, ch, unit)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
+		}
 	}
 
 	// Collect metrics from dbus
@@ -424,32 +1038,111 @@ func (c *Collector) collectUnit(conn *dbus.Conn, ch chan<- prometheus.Metric, un
 		if err != nil {
 			logger.Warnf(errUnitMetricsMsg, err)
 		}
-		err = c.collectServiceProcessMetrics(conn, ch, unit)
-		if err != nil {
-			logger.Warnf(errUnitMetricsMsg, err)
+		if *enableLimitMetrics {
+			err = c.collectServiceLimitMetrics(conn, ch, unit, scope)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
 		}
-
 		if *enableIPAccountingMetrics {
 			err = c.collectIPAccountingMetrics(conn, ch, unit)
 			if err != nil {
 				logger.Warnf(errUnitMetricsMsg, err)
 			}
 		}
+		// Everything below reads the service's processes from --path.procfs
+		if !scope.sharesHost() {
+			break
+		}
+		err = c.collectServiceProcessMetrics(conn, ch, unit, cgroupPath)
+		if err != nil {
+			logger.Warnf(errUnitMetricsMsg, err)
+		}
+		if *enableProcessStateMetrics {
+			err = c.collectServiceProcessStateMetrics(conn, ch, unit, cgroupPath)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
+		}
+		if *enableFDTypeMetrics {
+			err = c.collectServiceFDTypeMetrics(conn, ch, unit, cgroupPath)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
+		}
+		if *enableUnitSocketMetrics {
+			err = c.collectServiceSocketMetrics(conn, ch, unit, cgroupPath)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
+		}
+		if *enableStaleMappedFilesMetrics {
+			err = c.collectStaleMappedFilesMetrics(conn, ch, unit, cgroupPath)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
+		}
 	case "mount":
 		err = c.collectMountMetainfo(conn, ch, unit)
 		if err != nil {
 			logger.Warnf(errUnitMetricsMsg, err)
 		}
+		err = c.collectMountMetrics(conn, ch, unit, scope)
+		if err != nil {
+			logger.Warnf(errUnitMetricsMsg, err)
+		}
 	case "timer":
 		err := c.collectTimerTriggerTime(conn, ch, unit)
 		if err != nil {
 			logger.Warnf(errUnitMetricsMsg, err)
 		}
 	case "socket":
+		c.collectUnitMetainfo(conn, ch, unit)
 		err := c.collectSocketConnMetrics(conn, ch, unit)
 		if err != nil {
 			logger.Warnf(errUnitMetricsMsg, err)
 		}
+		err = c.collectSocketListenMetrics(conn, ch, unit, scope)
+		if err != nil {
+			logger.Warnf(errUnitMetricsMsg, err)
+		}
+	case "swap":
+		c.collectUnitMetainfo(conn, ch, unit)
+		err := c.collectSwapMetrics(conn, ch, unit, scope)
+		if err != nil {
+			logger.Warnf(errUnitMetricsMsg, err)
+		}
+	case "automount":
+		err := c.collectAutomountMetrics(conn, ch, unit)
+		if err != nil {
+			logger.Warnf(errUnitMetricsMsg, err)
+		}
+	case "path":
+		err := c.collectPathMetrics(conn, ch, unit)
+		if err != nil {
+			logger.Warnf(errUnitMetricsMsg, err)
+		}
+	case "slice", "scope":
+		c.collectUnitMetainfo(conn, ch, unit)
+		if *enableContainerMetrics && scope.sharesHost() {
+			err := c.collectContainerMetrics(ch, unit)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
+		}
+		if !*enableKubernetesMetrics {
+			break
+		}
+		// Scopes are skipped by the cgroup metrics above, so their cgroup is looked up here
+		if cgroupPath == nil {
+			cgroupPath, err = c.getControlGroup(conn, unit)
+			if err != nil {
+				logger.Warnf(errUnitMetricsMsg, err)
+			}
+		}
+		if cgroupPath != nil {
+			c.collectKubernetesMetrics(ch, unit, *cgroupPath)
+		}
 	default:
 		c.logger.Debugf(infoUnitNoHandler, unit.Name)
 	}
@@ -474,6 +1167,79 @@ func (c *Collector) collectUnitState(conn *dbus.Conn, ch chan<- prometheus.Metri
 	return nil
 }
 
+// collectUnitInvocationID reports the ID systemd assigns every time a unit is started, so each restart is
+// distinguishable and can be correlated with its journal entries. Units which never ran have no invocation ID.
+// The properties are those of the Unit interface, fetched once per unit.
+func (c *Collector) collectUnitInvocationID(ch chan<- prometheus.Metric, unit dbus.UnitStatus, properties map[string]interface{}) error {
+	invocationID, ok := properties["InvocationID"].([]byte)
+	if !ok {
+		return errors.Errorf(errConvertArrayPropertyMsg, "InvocationID", properties["InvocationID"])
+	}
+	if len(invocationID) == 0 {
+		return nil
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.unitInvocationInfo, prometheus.GaugeValue, 1.0,
+		unit.Name, hex.EncodeToString(invocationID))
+	return nil
+}
+
+// collectUnitConfigMetrics reports whether the unit's on-disk configuration has diverged from what systemd
+// (or the running unit) is using, so that a missing daemon-reload or restart after a unit file change is visible.
+// The properties are those of the Unit interface, fetched once per unit. The unit files are only compared for managers
+// sharing the exporter's host.
+func (c *Collector) collectUnitConfigMetrics(ch chan<- prometheus.Metric, unit dbus.UnitStatus, properties map[string]interface{}, scope managerScope) error {
+	needDaemonReload, ok := properties["NeedDaemonReload"].(bool)
+	if !ok {
+		return errors.Errorf(errConvertBoolPropertyMsg, "NeedDaemonReload", properties["NeedDaemonReload"])
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.unitNeedsDaemonReloadDesc, prometheus.GaugeValue,
+		boolToFloat64(needDaemonReload), unit.Name, parseUnitType(unit))
+	if !scope.sharesHost() {
+		return nil
+	}
+
+	paths, err := unitFilePaths(properties)
+	if err != nil {
+		return err
+	}
+
+	var activeEnterUsec uint64
+	if unit.ActiveState == "active" {
+		activeEnterUsec, ok = properties["ActiveEnterTimestamp"].(uint64)
+		if !ok {
+			return errors.Errorf(errConvertUint64PropertyMsg, "ActiveEnterTimestamp", properties["ActiveEnterTimestamp"])
+		}
+	}
+
+	configNewer := false
+	if activeEnterUsec > 0 {
+		modTime, err := latestModTime(paths)
+		if err != nil {
+			return errors.Wrap(err, "couldn't stat unit files")
+		}
+		configNewer = modTime.After(time.Unix(0, int64(activeEnterUsec)*int64(time.Microsecond)))
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.unitConfigNewerThanStartDesc, prometheus.GaugeValue,
+		boolToFloat64(configNewer), unit.Name, parseUnitType(unit))
+	return nil
+}
+
+// unitFilePaths returns the fragment and drop-in paths of a unit from its Unit properties.
+func unitFilePaths(properties map[string]interface{}) ([]string, error) {
+	fragmentPath, ok := properties["FragmentPath"].(string)
+	if !ok {
+		return nil, errors.Errorf(errConvertStringPropertyMsg, "FragmentPath", properties["FragmentPath"])
+	}
+	dropInPaths, ok := properties["DropInPaths"].([]string)
+	if !ok {
+		return nil, errors.Errorf(errConvertArrayPropertyMsg, "DropInPaths", properties["DropInPaths"])
+	}
+	return append([]string{fragmentPath}, dropInPaths...), nil
+}
+
 // TODO metric is named unit but function is "Mount"
 func (c *Collector) collectMountMetainfo(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus) error {
 	// TODO: wrap GetUnitTypePropertyString(
@@ -489,7 +1255,7 @@ func (c *Collector) collectMountMetainfo(conn *dbus.Conn, ch chan<- prometheus.M
 
 	ch <- prometheus.MustNewConstMetric(
 		c.unitInfo, prometheus.GaugeValue, 1.0,
-		unit.Name, parseUnitType(unit), serviceType, "")
+		unit.Name, parseUnitType(unit), serviceType, "", "", "", c.unitSlice(conn, unit), unit.Description)
 
 	return nil
 }
@@ -505,9 +1271,10 @@ func (c *Collector) collectServiceMetainfo(conn *dbus.Conn, ch chan<- prometheus
 		return errors.Errorf(errConvertStringPropertyMsg, "Type", serviceTypeProperty.Value.Value())
 	}
 
+	template, instance := parseUnitTemplate(unit.Name)
 	ch <- prometheus.MustNewConstMetric(
 		c.unitInfo, prometheus.GaugeValue, 1.0,
-		unit.Name, parseUnitType(unit), "", serviceType)
+		unit.Name, parseUnitType(unit), "", serviceType, template, instance, c.unitSlice(conn, unit), unit.Description)
 	return nil
 }
 
@@ -553,30 +1320,34 @@ func (c *Collector) collectServiceStartTimeMetrics(conn *dbus.Conn, ch chan<- pr
 	return nil
 }
 
-func (c *Collector) collectServiceProcessMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus) error {
-	// TODO: ExecStart type property, has a slice with process information.
-	// When systemd manages multiple processes, maybe we should add them all?
-
-	mainPID, err := conn.GetUnitTypeProperty(unit.Name, "Service", "MainPID")
+func (c *Collector) collectServiceProcessMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, unit dbus.UnitStatus, cgroupPath *string) error {
+	pid, err := getMainPID(conn, unit)
 	if err != nil {
-		return errors.Wrapf(err, errGetPropertyMsg, "MainPID")
-	}
-
-	pid, ok := mainPID.Value.Value().(uint32)
-	if !ok {
-		return errors.Errorf(errConvertUint32PropertyMsg, "MainPID", mainPID.Value.Value())
+		return err
 	}
 
 	// MainPID 0 when the service currently has no main PID
-	if pid == 0 {
-		return nil
+	if pid != 0 {
+		err = c.collectMainProcessMetrics(ch, unit, int(pid))
+		if err != nil {
+			return err
+		}
 	}
 
-	fs, err := procfs.NewFS(*procPath)
-	if err != nil {
-		return err
+	// Forking services and services without a main process are only fully accounted for by looking at every
+	// process in their control group
+	if *enableAllProcessesMetrics && cgroupPath != nil {
+		err = c.collectAllProcessesMetrics(ch, unit, *cgroupPath)
+		if err != nil {
+			return err
+		}
 	}
-	p, err := fs.Proc(int(pid))
+
+	return nil
+}
+
+func (c *Collector) collectMainProcessMetrics(ch chan<- prometheus.Metric, unit dbus.UnitStatus, pid int) error {
+	p, err := c.procFS.Proc(pid)
 	if err != nil {
 		return err
 	}
@@ -588,20 +1359,20 @@ func (c *Collector) collectServiceProcessMetrics(conn *dbus.Conn, ch chan<- prom
 
 	ch <- prometheus.MustNewConstMetric(
 		c.cpuTotalDesc, prometheus.CounterValue,
-		stat.CPUTime(), unit.Name)
+		stat.CPUTime(), unit.Name, processScopeMain)
 	ch <- prometheus.MustNewConstMetric(c.vsize, prometheus.GaugeValue,
-		float64(stat.VirtualMemory()), unit.Name)
+		float64(stat.VirtualMemory()), unit.Name, processScopeMain)
 	ch <- prometheus.MustNewConstMetric(c.rss, prometheus.GaugeValue,
-		float64(stat.ResidentMemory()), unit.Name)
+		float64(stat.ResidentMemory()), unit.Name, processScopeMain)
 
 	limits, err := p.Limits()
 	if err != nil {
 		return errors.Wrap(err, "couldn't get process limits")
 	}
 	ch <- prometheus.MustNewConstMetric(c.maxFDs, prometheus.GaugeValue,
-		float64(limits.OpenFiles), unit.Name)
+		float64(limits.OpenFiles), unit.Name, processScopeMain)
 	ch <- prometheus.MustNewConstMetric(c.maxVsize, prometheus.GaugeValue,
-		float64(limits.AddressSpace), unit.Name)
+		float64(limits.AddressSpace), unit.Name, processScopeMain)
 
 	if *enableFDMetrics {
 		fds, err := p.FileDescriptorsLen()
@@ -609,12 +1380,133 @@ func (c *Collector) collectServiceProcessMetrics(conn *dbus.Conn, ch chan<- prom
 			return errors.Wrap(err, "couldn't get process file descriptor size")
 		}
 		ch <- prometheus.MustNewConstMetric(c.openFDs, prometheus.GaugeValue,
-			float64(fds), unit.Name)
+			float64(fds), unit.Name, processScopeMain)
+		ch <- prometheus.MustNewConstMetric(c.fdUtilization, prometheus.GaugeValue,
+			fdUtilization(fds, limits.OpenFiles), unit.Name, processScopeMain)
+	}
+
+	return nil
+}
+
+// collectAllProcessesMetrics sums the process metrics of every process in the unit's control group. Limits are
+// per process and can't be summed, so they are only reported for the main process. The CPU time of exited processes
+// would be lost from a sum over the current processes, so it is read from the control group instead.
+func (c *Collector) collectAllProcessesMetrics(ch chan<- prometheus.Metric, unit dbus.UnitStatus, cgroupPath string) error {
+	pids, err := c.controlGroupPIDs(cgroupPath)
+	if err != nil {
+		return err
+	}
+	totals, err := c.sumProcesses(pids, *enableFDMetrics)
+	if err != nil {
+		return err
+	}
+
+	cpuUsage, err := cgroup.NewCPUUsage(c.controlGroupMode, c.controlGroupMountPrefix, cgroupPath)
+	if err != nil {
+		if perr, ok := err.(*os.PathError); !ok || perr.Op != "open" {
+			return errors.Wrapf(err, errControlGroupReadMsg, "CPU usage")
+		}
+	} else if cpuUsage != nil {
+		ch <- prometheus.MustNewConstMetric(
+			c.cpuTotalDesc, prometheus.CounterValue,
+			cpuUsage.UserSeconds()+cpuUsage.SystemSeconds(), unit.Name, processScopeAll)
+	}
+	ch <- prometheus.MustNewConstMetric(c.vsize, prometheus.GaugeValue,
+		float64(totals.virtualMemory), unit.Name, processScopeAll)
+	ch <- prometheus.MustNewConstMetric(c.rss, prometheus.GaugeValue,
+		float64(totals.residentMemory), unit.Name, processScopeAll)
+	if *enableFDMetrics {
+		ch <- prometheus.MustNewConstMetric(c.openFDs, prometheus.GaugeValue,
+			float64(totals.fds), unit.Name, processScopeAll)
 	}
 
 	return nil
 }
 
+// processTotals are the memory and file descriptors of a set of processes.
+type processTotals struct {
+	virtualMemory  uint64
+	residentMemory int
+	fds            int
+}
+
+// sumProcesses sums the memory and, if withFDs is set, the open file descriptors of the given processes. Processes
+// which exit while they are read are left out entirely.
+func (c *Collector) sumProcesses(pids []int, withFDs bool) (processTotals, error) {
+	var totals processTotals
+	for _, pid := range pids {
+		p, err := c.procFS.Proc(pid)
+		if err != nil {
+			// The process may have exited since we listed it
+			if os.IsNotExist(err) {
+				continue
+			}
+			return processTotals{}, err
+		}
+		stat, err := p.Stat()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return processTotals{}, err
+		}
+		var fds int
+		if withFDs {
+			fds, err = p.FileDescriptorsLen()
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return processTotals{}, errors.Wrap(err, "couldn't get process file descriptor size")
+			}
+		}
+
+		totals.virtualMemory += uint64(stat.VirtualMemory())
+		totals.residentMemory += stat.ResidentMemory()
+		totals.fds += fds
+	}
+	return totals, nil
+}
+
+func getMainPID(conn *dbus.Conn, unit dbus.UnitStatus) (uint32, error) {
+	mainPID, err := conn.GetUnitTypeProperty(unit.Name, "Service", "MainPID")
+	if err != nil {
+		return 0, errors.Wrapf(err, errGetPropertyMsg, "MainPID")
+	}
+
+	pid, ok := mainPID.Value.Value().(uint32)
+	if !ok {
+		return 0, errors.Errorf(errConvertUint32PropertyMsg, "MainPID", mainPID.Value.Value())
+	}
+	return pid, nil
+}
+
+// unitPIDs returns the processes to inspect for a service. When allProcesses is set and the unit has a control group,
+// every process in the control group is returned, otherwise only MainPID (if any).
+func (c *Collector) unitPIDs(conn *dbus.Conn, unit dbus.UnitStatus, cgroupPath *string, allProcesses bool) ([]int, error) {
+	if allProcesses && cgroupPath != nil {
+		return c.controlGroupPIDs(*cgroupPath)
+	}
+
+	pid, err := getMainPID(conn, unit)
+	if err != nil {
+		return nil, err
+	}
+	if pid == 0 {
+		return nil, nil
+	}
+	return []int{int(pid)}, nil
+}
+
+// controlGroupPIDs returns every process in the given control group and its descendants.
+func (c *Collector) controlGroupPIDs(cgroupPath string) ([]int, error) {
+	pids, err := cgroup.NewProcs(c.controlGroupMode, c.controlGroupMountPrefix, cgroupPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, errControlGroupReadMsg, "processes")
+	}
+	return pids, nil
+}
+
 func (c *Collector) mustGetUnitStringTypeProperty(unitType string,
 	propName string, defaultVal string, conn *dbus.Conn, unit dbus.UnitStatus) string {
 	prop, err := conn.GetUnitTypeProperty(unit.Name, unitType, propName)
@@ -834,23 +1726,17 @@ func (c *Collector) collectTimerTriggerTime(conn *dbus.Conn, ch chan<- prometheu
 }
 
 func (c *Collector) newDbus() (*dbus.Conn, error) {
-	if *systemdPrivate {
-		return dbus.NewSystemdConnection()
-	}
-	if *systemdUser {
-		return newUserConnection()
-	}
-	return dbus.New()
+	return newDefaultConnection()
 }
 
 func newUserConnection() (*dbus.Conn, error) {
 	return dbus.NewConnection(func() (*godbus.Conn, error) {
-		return dbusAuthHelloConnection(godbus.SessionBusPrivate)
+		return dbusAuthHelloConnection(godbus.SessionBusPrivate, *uid)
 	})
 }
 
-func dbusAuthHelloConnection(createBus func(opts ...godbus.ConnOption) (*godbus.Conn, error)) (*godbus.Conn, error) {
-	conn, err := dbusAuthConnection(createBus)
+func dbusAuthHelloConnection(createBus func(opts ...godbus.ConnOption) (*godbus.Conn, error), uid int) (*godbus.Conn, error) {
+	conn, err := dbusAuthConnection(createBus, uid)
 	if err != nil {
 		return nil, err
 	}
@@ -863,7 +1749,9 @@ func dbusAuthHelloConnection(createBus func(opts ...godbus.ConnOption) (*godbus.
 	return conn, nil
 }
 
-func dbusAuthConnection(createBus func(opts ...godbus.ConnOption) (*godbus.Conn, error)) (*godbus.Conn, error) {
+// dbusAuthConnection authenticates as uid, which must match the credentials of the exporter's process as seen by the
+// other end of the connection.
+func dbusAuthConnection(createBus func(opts ...godbus.ConnOption) (*godbus.Conn, error), uid int) (*godbus.Conn, error) {
 	conn, err := createBus()
 	if err != nil {
 		return nil, err
@@ -872,7 +1760,7 @@ func dbusAuthConnection(createBus func(opts ...godbus.ConnOption) (*godbus.Conn,
 	// Only use EXTERNAL method, and uid (not username) to avoid
 	// a username lookup (which requires a dynamically linked
 	// libc)
-	methods := []godbus.Auth{godbus.AuthExternal(strconv.Itoa(*uid))}
+	methods := []godbus.Auth{godbus.AuthExternal(strconv.Itoa(uid))}
 
 	err = conn.Auth(methods)
 	if err != nil {
@@ -883,6 +1771,69 @@ func dbusAuthConnection(createBus func(opts ...godbus.ConnOption) (*godbus.Conn,
 	return conn, nil
 }
 
+// latestModTime returns the most recent modification time of the given host paths. Empty and missing paths are
+// skipped, since a removed unit file is already reported through NeedDaemonReload.
+func latestModTime(paths []string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(rootfsFilePath(path))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func rootfsFilePath(name string) string {
+	return filepath.Join(*rootPath, name)
+}
+
+// procFilePath returns the path of a file in the /proc/X directory of a process, for the files procfs has no
+// accessor for. It is rooted at the same mountpoint as c.procFS.
+func (c *Collector) procFilePath(pid int, name ...string) string {
+	return filepath.Join(append([]string{c.procPath, strconv.Itoa(pid)}, name...)...)
+}
+
+// parseStringPairs decodes an a(ss) property such as the Listen property of sockets or the Paths property of paths.
+func parseStringPairs(property string, value interface{}) ([][2]string, error) {
+	entries, ok := value.([][]interface{})
+	if !ok {
+		return nil, errors.Errorf(errConvertArrayPropertyMsg, property, value)
+	}
+	pairs := make([][2]string, 0, len(entries))
+	for _, entry := range entries {
+		if len(entry) != 2 {
+			return nil, errors.Errorf(errConvertArrayPropertyMsg, property, value)
+		}
+		var pair [2]string
+		for i := range pair {
+			s, ok := entry[i].(string)
+			if !ok {
+				return nil, errors.Errorf(errConvertStringPropertyMsg, property, entry[i])
+			}
+			pair[i] = s
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+func boolToFloat64(b bool) float64 {
+	if b {
+		return 1.0
+	}
+	return 0.0
+}
+
 func filterUnits(units []dbus.UnitStatus, whitelistPattern, blacklistPattern *regexp.Regexp) []dbus.UnitStatus {
 	filtered := make([]dbus.UnitStatus, 0, len(units))
 	for _, unit := range units {
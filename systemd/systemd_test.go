@@ -16,10 +16,39 @@
 package systemd
 
 import (
-	"github.com/coreos/go-systemd/dbus"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/dbus"
+	godbus "github.com/godbus/dbus"
+	"github.com/kadaan/systemd_exporter/cgroup"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/procfs"
+	"golang.org/x/sys/unix"
 )
 
+const testFixturesProc = "fixtures/proc"
+
 func TestParseUnitType(t *testing.T) {
 	x := dbus.UnitStatus{
 		Name:        "test.service",
@@ -39,3 +68,1394 @@ func TestParseUnitType(t *testing.T) {
 	}
 
 }
+
+func TestLatestModTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fragment := filepath.Join(dir, "test.service")
+	dropIn := filepath.Join(dir, "override.conf")
+	for _, path := range []string{fragment, dropIn} {
+		if err := ioutil.WriteFile(path, []byte("[Unit]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := time.Unix(1600000000, 0)
+	if err := os.Chtimes(fragment, expected.Add(-time.Hour), expected.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(dropIn, expected, expected); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := latestModTime([]string{"", fragment, dropIn, filepath.Join(dir, "missing.conf")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found.Equal(expected) {
+		t.Errorf("Bad latest modification time. Wanted %s got %s", expected, found)
+	}
+}
+
+func TestCollectUnitConfigMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fragment := filepath.Join(dir, "test.service")
+	if err := ioutil.WriteFile(fragment, []byte("[Unit]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Unix(1600000000, 0)
+	if err := os.Chtimes(fragment, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Collector{
+		unitNeedsDaemonReloadDesc:    prometheus.NewDesc("systemd_unit_needs_daemon_reload", "", []string{"name", "type"}, nil),
+		unitConfigNewerThanStartDesc: prometheus.NewDesc("systemd_unit_config_newer_than_start", "", []string{"name", "type"}, nil),
+	}
+	unit := dbus.UnitStatus{Name: "test.service", ActiveState: "active"}
+	tests := []struct {
+		activeEnter uint64
+		expected    float64
+	}{
+		{uint64(modTime.Add(-time.Hour).UnixNano() / 1000), 1.0},
+		{uint64(modTime.Add(time.Hour).UnixNano() / 1000), 0.0},
+	}
+	for _, tt := range tests {
+		properties := map[string]interface{}{
+			"NeedDaemonReload":     true,
+			"FragmentPath":         fragment,
+			"DropInPaths":          []string{},
+			"ActiveEnterTimestamp": tt.activeEnter,
+		}
+		ch := make(chan prometheus.Metric, 2)
+		if err := c.collectUnitConfigMetrics(ch, unit, properties, systemScope); err != nil {
+			t.Fatal(err)
+		}
+		close(ch)
+		var values []float64
+		for m := range ch {
+			var metric dto.Metric
+			if err := m.Write(&metric); err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, metric.GetGauge().GetValue())
+		}
+		expected := []float64{1.0, tt.expected}
+		if !reflect.DeepEqual(values, expected) {
+			t.Errorf("Bad config metrics for start %d. Wanted %v got %v", tt.activeEnter, expected, values)
+		}
+	}
+
+	if err := c.collectUnitConfigMetrics(make(chan prometheus.Metric, 2), unit, map[string]interface{}{}, systemScope); err == nil {
+		t.Error("Expected error for missing properties")
+	}
+
+	// The unit files of probed managers aren't on the exporter's host
+	ch := make(chan prometheus.Metric, 2)
+	properties := map[string]interface{}{"NeedDaemonReload": false, "FragmentPath": fragment}
+	if err := c.collectUnitConfigMetrics(ch, unit, properties, probeScope); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch) != 1 {
+		t.Errorf("Expected only the daemon reload metric of a probed unit, got %d metrics", len(ch))
+	}
+}
+
+func TestParseDeletedPath(t *testing.T) {
+	tables := []struct {
+		pathname string
+		expected string
+		ok       bool
+	}{
+		{"/usr/lib/libssl.so.1.1 (deleted)", "/usr/lib/libssl.so.1.1", true},
+		{"/usr/lib/libssl.so.1.1", "", false},
+		{"/memfd:pulseaudio (deleted)", "", false},
+		{"/dev/shm/foo (deleted)", "", false},
+		{"[heap]", "", false},
+		{"", "", false},
+	}
+
+	for _, table := range tables {
+		path, ok := parseDeletedPath(table.pathname)
+		if path != table.expected || ok != table.ok {
+			t.Errorf("Bad deleted path parsing of %q. Wanted (%q, %t) got (%q, %t)", table.pathname, table.expected, table.ok, path, ok)
+		}
+	}
+}
+
+func TestStaleMappedFiles(t *testing.T) {
+	p := getProcFixture(t, 1042)
+	found, err := staleMappedFiles(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/usr/lib/x86_64-linux-gnu/libssl.so.1.1", "/usr/sbin/foo"}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Bad stale mapped files. Wanted %v got %v", expected, found)
+	}
+}
+
+func getProcFixture(t *testing.T, pid int) procfs.Proc {
+	fs, err := procfs.NewFS(testFixturesProc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := fs.Proc(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSumProcesses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 1043 exited while it was read, its fd directory is gone but its stat was still readable
+	stat, err := ioutil.ReadFile(filepath.Join(testFixturesProc, "1042", "stat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "1043"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "1043", "stat"), stat, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(mustAbs(t, testFixturesProc), "1042"), filepath.Join(dir, "1042")); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := procfs.NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Collector{procFS: fs}
+	expected := processTotals{
+		virtualMemory:  119463936,
+		residentMemory: 4698 * os.Getpagesize(),
+		fds:            6,
+	}
+	totals, err := c.sumProcesses([]int{1042, 1043, 1044}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals != expected {
+		t.Errorf("Bad process totals. Wanted %+v got %+v", expected, totals)
+	}
+
+	expected.virtualMemory *= 2
+	expected.residentMemory *= 2
+	expected.fds = 0
+	totals, err = c.sumProcesses([]int{1042, 1043}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals != expected {
+		t.Errorf("Bad process totals without fds. Wanted %+v got %+v", expected, totals)
+	}
+}
+
+func mustAbs(t *testing.T, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abs
+}
+
+func TestSmapsTotals(t *testing.T) {
+	rollup, err := getProcFixture(t, 1042).ProcSMapsRollup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var totals smapsTotals
+	totals.add(rollup)
+	totals.add(rollup)
+	expected := smapsTotals{Pss: 2 * 6712 * 1024, Uss: 2 * (896 + 6276) * 1024, SwapPss: 2 * 32 * 1024}
+	if totals != expected {
+		t.Errorf("Bad smaps totals. Wanted %+v got %+v", expected, totals)
+	}
+}
+
+func TestProcessIOTotals(t *testing.T) {
+	pio, err := getProcFixture(t, 1042).IO()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var totals processIOTotals
+	totals.add(pio)
+	totals.add(pio)
+	expected := processIOTotals{
+		RChar:               2 * 750339,
+		WChar:               2 * 818609,
+		SyscR:               2 * 7405,
+		SyscW:               2 * 5245,
+		ReadBytes:           2 * 1024,
+		WriteBytes:          2 * 2048,
+		CancelledWriteBytes: 2 * -1024,
+	}
+	if totals != expected {
+		t.Errorf("Bad process io totals. Wanted %+v got %+v", expected, totals)
+	}
+}
+
+func TestAddProcessState(t *testing.T) {
+	fs, err := procfs.NewFS(testFixturesProc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Collector{procFS: fs, procPath: testFixturesProc}
+
+	var totals processStateTotals
+	if err := c.addProcessState(&totals, 1042); err != nil {
+		t.Fatal(err)
+	}
+	expected := processStateTotals{States: map[string]int{"S": 1}, Threads: 3, Voluntary: 140, NonVoluntary: 14}
+	if !reflect.DeepEqual(totals, expected) {
+		t.Errorf("Bad process state totals. Wanted %+v got %+v", expected, totals)
+	}
+}
+
+func TestAddProcessFDTypes(t *testing.T) {
+	fs, err := procfs.NewFS(testFixturesProc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Collector{procFS: fs}
+
+	fdTypes := map[string]int{}
+	utilization, err := c.addProcessFDTypes(fdTypes, 1042)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{"socket": 2, "pipe": 1, "eventfd": 1, "anon_inode": 1, "file": 1}
+	if !reflect.DeepEqual(fdTypes, expected) {
+		t.Errorf("Bad file descriptor types. Wanted %v got %v", expected, fdTypes)
+	}
+	if expected := 6.0 / 1024; utilization != expected {
+		t.Errorf("Bad file descriptor utilization. Wanted %f got %f", expected, utilization)
+	}
+}
+
+func TestParseProcessLimits(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join(testFixturesProc, "1042", "limits"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits, err := parseProcessLimits(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(limits) != len(limitResources) {
+		t.Errorf("Wrong number of limits. Wanted %d got %d", len(limitResources), len(limits))
+	}
+	tables := map[string]processLimit{
+		"nofile": {Soft: 1024, Hard: 524288},
+		"stack":  {Soft: 8388608, Hard: math.Inf(1)},
+		"nice":   {Soft: 0, Hard: 0},
+		"rttime": {Soft: math.Inf(1), Hard: math.Inf(1)},
+	}
+	for resource, expected := range tables {
+		if limits[resource] != expected {
+			t.Errorf("Bad %s limit. Wanted %+v got %+v", resource, expected, limits[resource])
+		}
+	}
+}
+
+func TestReadNetSockets(t *testing.T) {
+	c := &Collector{procPath: testFixturesProc}
+	sockets, err := c.readNetSockets(1042)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []netSocket{
+		{Protocol: "tcp", LocalAddr: net.IPv4(0, 0, 0, 0).To4(), LocalPort: 22, State: 0x0A, RxQueue: 3, Inode: 20001},
+		{Protocol: "tcp", LocalAddr: net.IPv4(127, 0, 0, 1).To4(), LocalPort: 3306, State: 0x0A, RxQueue: 0, Inode: 30001},
+		{Protocol: "tcp", LocalAddr: net.IPv4(10, 0, 2, 15).To4(), LocalPort: 22, State: 0x01, RxQueue: 0, Inode: 20003},
+		{Protocol: "tcp6", LocalAddr: net.IPv6zero, LocalPort: 22, State: 0x0A, RxQueue: 1, Inode: 20004},
+		{Protocol: "udp", LocalAddr: net.IPv4(127, 0, 0, 53).To4(), LocalPort: 53, State: 0x07, RxQueue: 0, Inode: 20005},
+	}
+	if !reflect.DeepEqual(sockets, expected) {
+		t.Errorf("Bad network sockets. Wanted %+v got %+v", expected, sockets)
+	}
+}
+
+func TestNetNamespacePIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for pid, ns := range map[string]string{"1": "net:[4026531992]", "2": "net:[4026531992]", "3": "net:[4026532281]"} {
+		if err := os.MkdirAll(filepath.Join(dir, pid, "ns"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(ns, filepath.Join(dir, pid, "ns", "net")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &Collector{procPath: dir}
+	pids := c.netNamespacePIDs([]int{1, 2, 3, 4, 5})
+	expected := []int{1, 3, 4}
+	if !reflect.DeepEqual(pids, expected) {
+		t.Errorf("Bad network namespace pids. Wanted %v got %v", expected, pids)
+	}
+}
+
+func TestSocketInode(t *testing.T) {
+	if inode, ok := socketInode("socket:[20001]"); !ok || inode != 20001 {
+		t.Errorf("Bad socket inode parsing. Wanted %d got %d", 20001, inode)
+	}
+	for _, target := range []string{"pipe:[20002]", "socket:[]", "/var/log/foo.log"} {
+		if _, ok := socketInode(target); ok {
+			t.Errorf("Expected %q not to be a socket", target)
+		}
+	}
+}
+
+func TestParseSocketListen(t *testing.T) {
+	value := [][]interface{}{{"Stream", "[::]:22"}, {"Datagram", "/run/foo.sock"}}
+	listens, err := parseSocketListen(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []socketListen{{"Stream", "[::]:22"}, {"Datagram", "/run/foo.sock"}}
+	if !reflect.DeepEqual(listens, expected) {
+		t.Errorf("Bad socket listen parsing. Wanted %v got %v", expected, listens)
+	}
+
+	if _, err := parseSocketListen([]string{"Stream"}); err == nil {
+		t.Errorf("expected error parsing bogus Listen property")
+	}
+}
+
+func TestListenQueueLength(t *testing.T) {
+	c := &Collector{procPath: testFixturesProc}
+	sockets, err := c.readNetSockets(1042)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables := []struct {
+		address  string
+		expected uint64
+		ok       bool
+	}{
+		{"0.0.0.0:22", 3, true},
+		{"[::]:22", 1, true},
+		{"22", 3, true},
+		{"127.0.0.1:3306", 0, true},
+		{"127.0.0.1:22", 0, false},
+		{"/run/foo.sock", 0, false},
+	}
+	for _, table := range tables {
+		queue, ok := listenQueueLength(sockets, table.address)
+		if queue != table.expected || ok != table.ok {
+			t.Errorf("Bad listen queue length of %s. Wanted (%d, %t) got (%d, %t)", table.address, table.expected, table.ok, queue, ok)
+		}
+	}
+}
+
+func TestStatFilesystem(t *testing.T) {
+	defer func() { statfsFunc = unix.Statfs }()
+	statfsFunc = func(path string, buf *unix.Statfs_t) error {
+		buf.Bsize = 4096
+		buf.Blocks = 1000
+		buf.Bfree = 400
+		buf.Bavail = 300
+		buf.Files = 64
+		buf.Ffree = 16
+		return nil
+	}
+
+	stats, err := statFilesystem("/srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := filesystemStats{
+		SizeBytes:  4096000,
+		FreeBytes:  1638400,
+		AvailBytes: 1228800,
+		Files:      64,
+		FilesFree:  16,
+	}
+	if stats != expected {
+		t.Errorf("Bad filesystem stats. Wanted %+v got %+v", expected, stats)
+	}
+}
+
+func TestStatMount(t *testing.T) {
+	defer func() { statfsFunc = unix.Statfs }()
+	defer func(prev time.Duration) { *mountStatfsTimeout = prev }(*mountStatfsTimeout)
+
+	var calls int32
+	release := make(chan struct{})
+	statfsFunc = func(path string, buf *unix.Statfs_t) error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		buf.Bsize = 4096
+		buf.Blocks = 1
+		return nil
+	}
+	c := &Collector{statfsCalls: map[string]*statfsCall{}}
+
+	// Overlapping scrapes wait for the statfs which is already running
+	*mountStatfsTimeout = time.Minute
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.statMount("/srv")
+		first <- err
+	}()
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release <- struct{}{}
+	}()
+	if _, err := c.statMount("/srv"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("Bad number of statfs calls of overlapping scrapes. Wanted 1 got %d", calls)
+	}
+
+	// Mount points whose statfs timed out are skipped until it returns
+	*mountStatfsTimeout = 10 * time.Millisecond
+	if _, err := c.statMount("/srv"); err == nil {
+		t.Fatal("Expected statfs timeout")
+	}
+	if _, err := c.statMount("/srv"); err == nil {
+		t.Fatal("Expected pending mount point to be skipped")
+	}
+	release <- struct{}{}
+	for {
+		c.statfsCallsMtx.Lock()
+		_, pending := c.statfsCalls["/srv"]
+		c.statfsCallsMtx.Unlock()
+		if !pending {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	*mountStatfsTimeout = time.Minute
+	go func() { release <- struct{}{} }()
+	stats, err := c.statMount("/srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.SizeBytes != 4096 {
+		t.Errorf("Bad filesystem size. Wanted 4096 got %d", stats.SizeBytes)
+	}
+}
+
+func TestFindSwap(t *testing.T) {
+	root, err := ioutil.TempDir("", "systemd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(prev string) { *rootPath = prev }(*rootPath)
+	*rootPath = root
+
+	if err := os.MkdirAll(filepath.Join(root, "dev/disk/by-uuid"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "dev/sda2"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../sda2", filepath.Join(root, "dev/disk/by-uuid/1234")); err != nil {
+		t.Fatal(err)
+	}
+
+	swaps := []*procfs.Swap{
+		{Filename: "/dev/sda2", Type: "partition", Size: 1024},
+		{Filename: `/swap\040file`, Type: "file", Size: 2048},
+	}
+	tables := []struct {
+		what     string
+		expected *procfs.Swap
+	}{
+		{"/dev/sda2", swaps[0]},
+		{"/dev/disk/by-uuid/1234", swaps[0]},
+		{"/swap file", swaps[1]},
+		{"/dev/sdb1", nil},
+	}
+	for _, table := range tables {
+		swap := findSwap(swaps, table.what)
+		if swap != table.expected {
+			t.Errorf("Bad swap for %s. Wanted %v got %v", table.what, table.expected, swap)
+		}
+	}
+}
+
+func TestAutomountMountUnit(t *testing.T) {
+	if mountUnit := automountMountUnit("mnt-nfs.automount"); mountUnit != "mnt-nfs.mount" {
+		t.Errorf("Bad automount mount unit. Wanted mnt-nfs.mount got %s", mountUnit)
+	}
+}
+
+func TestParseStringPairs(t *testing.T) {
+	value := [][]interface{}{{"PathExists", "/var/spool/foo"}, {"DirectoryNotEmpty", "/var/spool/bar"}}
+	pairs, err := parseStringPairs("Paths", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][2]string{{"PathExists", "/var/spool/foo"}, {"DirectoryNotEmpty", "/var/spool/bar"}}
+	if !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("Bad string pair parsing. Wanted %v got %v", expected, pairs)
+	}
+
+	if _, err := parseStringPairs("Paths", [][]interface{}{{"PathExists", 1}}); err == nil {
+		t.Errorf("expected error parsing bogus Paths property")
+	}
+}
+
+func TestIsUnmetDependency(t *testing.T) {
+	activeStates := unitActiveStates([]dbus.UnitStatus{
+		{Name: "foo.service", ActiveState: "active"},
+		{Name: "bar.service", ActiveState: "failed"},
+		{Name: "baz.service", ActiveState: "inactive"},
+	})
+
+	tables := []struct {
+		kind       string
+		dependency string
+		expected   bool
+	}{
+		{"Requires", "foo.service", false},
+		{"Requires", "bar.service", true},
+		{"Requires", "baz.service", true},
+		{"Requires", "missing.service", true},
+		{"BindsTo", "baz.service", true},
+		{"Wants", "foo.service", false},
+		{"Wants", "bar.service", true},
+		{"Wants", "baz.service", false},
+		{"Wants", "missing.service", false},
+		{"PartOf", "bar.service", true},
+	}
+	for _, table := range tables {
+		activeState, loaded := activeStates[table.dependency]
+		if unmet := isUnmetDependency(table.kind, activeState, loaded); unmet != table.expected {
+			t.Errorf("Bad unmet %s dependency %s. Wanted %t got %t", table.kind, table.dependency, table.expected, unmet)
+		}
+	}
+}
+
+func TestDependencyGraphWriteDOT(t *testing.T) {
+	graph := &DependencyGraph{
+		Nodes: []DependencyGraphNode{{"foo.service", "failed"}, {"multi-user.target", "active"}},
+		Edges: []DependencyGraphEdge{{"multi-user.target", "foo.service", "Wants"}},
+	}
+	var buf bytes.Buffer
+	if err := graph.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph systemd {
+	"foo.service" [label="foo.service\nfailed", color=red];
+	"multi-user.target" [label="multi-user.target\nactive", color=darkgreen];
+	"multi-user.target"->"foo.service" [color=grey66, label="Wants"];
+}
+`
+	if buf.String() != expected {
+		t.Errorf("Bad DOT output. Wanted %s got %s", expected, buf.String())
+	}
+}
+
+func TestCollectUnitFileLabels(t *testing.T) {
+	root, err := ioutil.TempDir("", "systemd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(prev string) { *rootPath = prev }(*rootPath)
+	*rootPath = root
+	defer func(prev int) { *unitFileLabelsLimit = prev }(*unitFileLabelsLimit)
+	*unitFileLabelsLimit = 10
+
+	if err := os.MkdirAll(filepath.Join(root, "etc/systemd/system"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "etc/systemd/system/foo.service"), []byte("[Unit]\nX-Prometheus-Label-team=storage\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The labels don't depend on the properties only needed by the config metrics
+	properties := map[string]interface{}{
+		"FragmentPath": "/etc/systemd/system/foo.service",
+		"DropInPaths":  []string{"/etc/systemd/system/foo.service.d/missing.conf"},
+	}
+	c := &Collector{}
+	ch := make(chan prometheus.Metric, 1)
+	if err := c.collectUnitFileLabels(ch, dbus.UnitStatus{Name: "foo.service"}, properties); err != nil {
+		t.Fatal(err)
+	}
+
+	var metric dto.Metric
+	if err := (<-ch).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	labels := make([]string, 0, len(metric.Label))
+	for _, label := range metric.Label {
+		labels = append(labels, label.GetName()+"="+label.GetValue())
+	}
+	expected := []string{"name=foo.service", "team=storage"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Bad unit file labels. Wanted %v got %v", expected, labels)
+	}
+}
+
+func TestCollectUnitInvocationID(t *testing.T) {
+	c := &Collector{
+		unitInvocationInfo: prometheus.NewDesc("systemd_unit_invocation_info", "", []string{"name", "invocation_id"}, nil),
+	}
+	unit := dbus.UnitStatus{Name: "foo.service"}
+
+	ch := make(chan prometheus.Metric, 1)
+	invocationID := []byte{0x5e, 0x1f, 0x2a, 0x00, 0x9b, 0x4c, 0x4d, 0x7e, 0x8f, 0x10, 0x21, 0x32, 0x43, 0x54, 0x65, 0x76}
+	if err := c.collectUnitInvocationID(ch, unit, map[string]interface{}{"InvocationID": invocationID}); err != nil {
+		t.Fatal(err)
+	}
+	var metric dto.Metric
+	if err := (<-ch).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	expected := "5e1f2a009b4c4d7e8f10213243546576"
+	for _, label := range metric.Label {
+		if label.GetName() == "invocation_id" && label.GetValue() != expected {
+			t.Errorf("Bad invocation ID. Wanted %s got %s", expected, label.GetValue())
+		}
+	}
+
+	// Units which never ran have an empty invocation ID
+	if err := c.collectUnitInvocationID(ch, unit, map[string]interface{}{"InvocationID": []byte{}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch) != 0 {
+		t.Errorf("Expected no invocation info for an unstarted unit")
+	}
+
+	if err := c.collectUnitInvocationID(ch, unit, map[string]interface{}{}); err == nil {
+		t.Errorf("Expected error for a missing invocation ID")
+	}
+}
+
+func TestCollectSliceMetrics(t *testing.T) {
+	prefix, err := ioutil.TempDir("", "systemd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(prefix)
+	slice := filepath.Join(prefix, cgroup.DefaultMountPoint, "idle.slice")
+	if err := os.MkdirAll(slice, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A slice which hasn't used any CPU time yet has no CPU usage
+	if err := ioutil.WriteFile(filepath.Join(slice, "cpu.stat"), []byte("usage_usec 0\nuser_usec 0\nsystem_usec 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Collector{
+		controlGroupMode:        cgroup.Unified,
+		controlGroupMountPrefix: prefix,
+		sliceCPUTotal:           prometheus.NewDesc("systemd_slice_cpu_seconds_total", "", []string{"name", "mode"}, nil),
+	}
+	ch := make(chan prometheus.Metric, 2)
+	if err := c.collectSliceMetrics("/idle.slice", ch, dbus.UnitStatus{Name: "idle.slice"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch) != 0 {
+		t.Errorf("Expected no CPU usage of an idle slice, got %d metrics", len(ch))
+	}
+}
+
+func TestDependencyGraphCache(t *testing.T) {
+	defer func(prev time.Duration) { *dependencyGraphCacheTTL = prev }(*dependencyGraphCacheTTL)
+	*dependencyGraphCacheTTL = time.Minute
+	defer func(prev bool) { *enableUserManagers = prev }(*enableUserManagers)
+	*enableUserManagers = false
+
+	system := &DependencyGraph{Nodes: []DependencyGraphNode{{Name: "multi-user.target", ActiveState: "active"}}}
+	user := &DependencyGraph{Nodes: []DependencyGraphNode{{Name: "default.target", ActiveState: "active"}}}
+	c := &Collector{
+		managerTargets: []managerTarget{{name: "system"}, {name: "user@1000"}},
+		dependencyGraphs: map[string]cachedDependencyGraph{
+			"system":    {system, time.Now()},
+			"user@1000": {user, time.Now()},
+		},
+	}
+
+	for manager, expected := range map[string]*DependencyGraph{"": system, "system": system, "user@1000": user} {
+		graph, err := c.DependencyGraph(manager)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if graph != expected {
+			t.Errorf("Expected cached dependency graph %+v of manager %q got %+v", expected, manager, graph)
+		}
+	}
+
+	if _, err := c.DependencyGraph("user@1001"); errors.Cause(err) != ErrUnknownManager {
+		t.Errorf("Expected unknown manager error, got %v", err)
+	}
+}
+
+func TestParseUnitTemplate(t *testing.T) {
+	tables := []struct {
+		name     string
+		template string
+		instance string
+	}{
+		{"worker@1.service", "worker@.service", "1"},
+		{"getty@tty1.service", "getty@.service", "tty1"},
+		{`systemd-fsck@dev-disk-by\x2duuid-1234.service`, "systemd-fsck@.service", "dev-disk-by-uuid-1234"},
+		{"user@1000.service", "user@.service", "1000"},
+		{"worker@.service", "worker@.service", ""},
+		{`foo@bar\x2.service`, "foo@.service", `bar\x2`},
+		{`foo@caf\xc3\xa9.service`, "foo@.service", "café"},
+		{`foo@caf\xe9.service`, "foo@.service", `caf\xe9`},
+		{"sshd.service", "", ""},
+	}
+	for _, table := range tables {
+		template, instance := parseUnitTemplate(table.name)
+		if template != table.template || instance != table.instance {
+			t.Errorf("Bad template parsing of %s. Wanted (%s, %s) got (%s, %s)", table.name, table.template, table.instance, template, instance)
+		}
+	}
+}
+
+func TestParseUnitFileLabels(t *testing.T) {
+	fragment := []byte(`[Unit]
+Description=Foo
+X-Prometheus-Label-team=storage
+X-Prometheus-Label-tier = backend
+X-Prometheus-Label-cost-center=12\
+  34
+# X-Prometheus-Label-commented=out
+X-Prometheus-Label-name=ignored
+X-Prometheus-Label-__team=reserved
+X-Prometheus-Label---team=reserved
+X-Prometheus-Label-manager=reserved
+X-Prometheus-Label-uid=reserved
+
+[Service]
+X-Prometheus-Label-section=ignored
+`)
+	dropIn := []byte(`[Unit]
+X-Prometheus-Label-tier=frontend
+X-Prometheus-Label-team=
+`)
+
+	labels := make(map[string]string)
+	for _, b := range [][]byte{fragment, dropIn} {
+		if err := parseUnitFileLabels(b, labels); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := map[string]string{"tier": "frontend", "cost_center": "12 34"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Bad unit file labels. Wanted %v got %v", expected, labels)
+	}
+}
+
+func TestDecodeKubernetesControlGroup(t *testing.T) {
+	containerID := "4b825dc642cb6eb9a060e54bf8d69288fbee4904e2a4a0f6e5b4a34e9f0a1c2d"
+	tables := []struct {
+		cgroupPath string
+		expected   kubernetesCgroup
+		ok         bool
+	}{
+		{"/kubepods.slice", kubernetesCgroup{}, true},
+		{"/kubepods.slice/kubepods-burstable.slice", kubernetesCgroup{QOSClass: "Burstable"}, true},
+		{"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0f5a3b1c_7d2e_4f6a_9b8c_1d2e3f4a5b6c.slice",
+			kubernetesCgroup{"Burstable", "0f5a3b1c-7d2e-4f6a-9b8c-1d2e3f4a5b6c", ""}, true},
+		{"/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0f5a3b1c_7d2e_4f6a_9b8c_1d2e3f4a5b6c.slice/cri-containerd-" + containerID + ".scope",
+			kubernetesCgroup{"BestEffort", "0f5a3b1c-7d2e-4f6a-9b8c-1d2e3f4a5b6c", containerID}, true},
+		{"/kubepods.slice/kubepods-pod0f5a3b1c_7d2e_4f6a_9b8c_1d2e3f4a5b6c.slice/crio-" + containerID + ".scope",
+			kubernetesCgroup{"Guaranteed", "0f5a3b1c-7d2e-4f6a-9b8c-1d2e3f4a5b6c", containerID}, true},
+		{"/kubepods/burstable/pod0f5a3b1c-7d2e-4f6a-9b8c-1d2e3f4a5b6c/" + containerID,
+			kubernetesCgroup{"Burstable", "0f5a3b1c-7d2e-4f6a-9b8c-1d2e3f4a5b6c", containerID}, true},
+		{"/kubepods/pod0f5a3b1c-7d2e-4f6a-9b8c-1d2e3f4a5b6c",
+			kubernetesCgroup{"Guaranteed", "0f5a3b1c-7d2e-4f6a-9b8c-1d2e3f4a5b6c", ""}, true},
+		{"/system.slice/docker-" + containerID + ".scope", kubernetesCgroup{}, false},
+	}
+	for _, table := range tables {
+		decoded, ok := decodeKubernetesControlGroup(table.cgroupPath)
+		if decoded != table.expected || ok != table.ok {
+			t.Errorf("Bad kubernetes decoding of %s. Wanted (%+v, %t) got (%+v, %t)", table.cgroupPath, table.expected, table.ok, decoded, ok)
+		}
+	}
+}
+
+func TestDecodeContainerScope(t *testing.T) {
+	id := "4b825dc642cb6eb9a060e54bf8d69288fbee4904e2a4a0f6e5b4a34e9f0a1c2d"
+	tables := []struct {
+		name    string
+		runtime string
+		id      string
+		ok      bool
+	}{
+		{"docker-" + id + ".scope", "docker", id, true},
+		{"libpod-" + id + ".scope", "podman", id, true},
+		{"libpod-conmon-" + id + ".scope", "", "", false},
+		{"session-42.scope", "", "", false},
+	}
+	for _, table := range tables {
+		runtime, id, ok := decodeContainerScope(table.name)
+		if runtime != table.runtime || id != table.id || ok != table.ok {
+			t.Errorf("Bad container scope decoding of %s. Wanted (%s, %s, %t) got (%s, %s, %t)", table.name, table.runtime, table.id, table.ok, runtime, id, ok)
+		}
+	}
+}
+
+func TestReadContainerMetadata(t *testing.T) {
+	docker, err := readDockerContainer("fixtures/rootfs/var/lib/docker", "4b825dc642cb6eb9a060e54bf8d69288fbee4904e2a4a0f6e5b4a34e9f0a1c2d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (containerMetadata{Name: "web", Image: "nginx:1.21"}); docker != expected {
+		t.Errorf("Bad docker container. Wanted %+v got %+v", expected, docker)
+	}
+
+	var containers podmanContainers
+	podman, err := containers.get("fixtures/rootfs/var/lib/containers/storage", "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (containerMetadata{Name: "db", Image: "docker.io/library/postgres:13"}); podman != expected {
+		t.Errorf("Bad podman container. Wanted %+v got %+v", expected, podman)
+	}
+}
+
+func TestParseLogindSession(t *testing.T) {
+	properties := map[string]godbus.Variant{
+		"Id":            godbus.MakeVariant("42"),
+		"Name":          godbus.MakeVariant("alice"),
+		"User":          godbus.MakeVariant([]interface{}{uint32(1000), godbus.ObjectPath("/org/freedesktop/login1/user/_1000")}),
+		"Seat":          godbus.MakeVariant([]interface{}{"", godbus.ObjectPath("/")}),
+		"Type":          godbus.MakeVariant("tty"),
+		"Class":         godbus.MakeVariant("user"),
+		"State":         godbus.MakeVariant("active"),
+		"RemoteHost":    godbus.MakeVariant("10.0.0.1"),
+		"Scope":         godbus.MakeVariant("session-42.scope"),
+		"IdleHint":      godbus.MakeVariant(true),
+		"IdleSinceHint": godbus.MakeVariant(uint64(1622541600000000)),
+	}
+	session, err := parseLogindSession(properties)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := logindSession{
+		ID: "42", UID: 1000, User: "alice", Seat: "", Type: "tty", Class: "user", State: "active",
+		RemoteHost: "10.0.0.1", Scope: "session-42.scope", Idle: true, IdleSince: 1622541600000000,
+	}
+	if session != expected {
+		t.Errorf("Bad logind session. Wanted %+v got %+v", expected, session)
+	}
+
+	delete(properties, "Scope")
+	if _, err := parseLogindSession(properties); err == nil {
+		t.Errorf("expected error parsing session without Scope")
+	}
+}
+
+func TestParseLogindUser(t *testing.T) {
+	properties := map[string]godbus.Variant{
+		"UID":         godbus.MakeVariant(uint32(1000)),
+		"Name":        godbus.MakeVariant("alice"),
+		"State":       godbus.MakeVariant("lingering"),
+		"Linger":      godbus.MakeVariant(true),
+		"RuntimePath": godbus.MakeVariant("/run/user/1000"),
+		"Slice":       godbus.MakeVariant("user-1000.slice"),
+		"Sessions":    godbus.MakeVariant([][]interface{}{}),
+	}
+	user, err := parseLogindUser(properties)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := logindUser{UID: 1000, Name: "alice", State: "lingering", Linger: true, RuntimePath: "/run/user/1000", Slice: "user-1000.slice"}
+	if user != expected {
+		t.Errorf("Bad logind user. Wanted %+v got %+v", expected, user)
+	}
+}
+
+func TestCollectWithLabels(t *testing.T) {
+	desc := prometheus.NewDesc("systemd_unit_state", "", []string{"name", "type"}, nil)
+	ch := make(chan prometheus.Metric, 1)
+	err := collectWithLabels(ch, map[string]string{"manager": "user", "uid": "1000"}, func(ch chan<- prometheus.Metric) error {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1.0, "foo.service", "service")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metric dto.Metric
+	if err := (<-ch).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	labels := make([]string, 0, len(metric.Label))
+	for _, label := range metric.Label {
+		labels = append(labels, label.GetName()+"="+label.GetValue())
+	}
+	expected := []string{"manager=user", "name=foo.service", "type=service", "uid=1000"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Bad labels. Wanted %v got %v", expected, labels)
+	}
+}
+
+// startDBusDaemon starts a dbus-daemon listening on the unix socket path, skipping the test if it isn't installed.
+func startDBusDaemon(t *testing.T, path string) func() {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	cmd := exec.Command(daemon, "--session", "--nofork", "--nopidfile", "--address=unix:path="+path)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	stop := func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			return stop
+		}
+	}
+	stop()
+	t.Fatalf("dbus-daemon didn't create %s", path)
+	return nil
+}
+
+// fakeSystemdPrivate serves ListUnits on a peer-to-peer socket like the private socket of systemd, and records the
+// uids connections authenticate as and the methods they call.
+type fakeSystemdPrivate struct {
+	listener net.Listener
+	units    []fakeSystemdUnit
+
+	mtx     sync.Mutex
+	uids    []string
+	members []string
+}
+
+func startFakeSystemdPrivate(t *testing.T, path string, units []fakeSystemdUnit) *fakeSystemdPrivate {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSystemdPrivate{listener: listener, units: units}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSystemdPrivate) Close() error {
+	return s.listener.Close()
+}
+
+func (s *fakeSystemdPrivate) serve(conn net.Conn) {
+	defer conn.Close()
+	in := bufio.NewReader(conn)
+	// Clients start with a null byte, followed by the line based authentication
+	if _, err := in.ReadByte(); err != nil {
+		return
+	}
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[0] == "AUTH" && fields[1] == "EXTERNAL":
+			uid, _ := hex.DecodeString(fields[2])
+			s.mtx.Lock()
+			s.uids = append(s.uids, string(uid))
+			s.mtx.Unlock()
+			fmt.Fprint(conn, "OK 0123456789abcdef0123456789abcdef\r\n")
+		case len(fields) > 0 && fields[0] == "AUTH":
+			fmt.Fprint(conn, "REJECTED EXTERNAL\r\n")
+		case len(fields) > 0 && fields[0] == "NEGOTIATE_UNIX_FD":
+			fmt.Fprint(conn, "AGREE_UNIX_FD\r\n")
+		case len(fields) > 0 && fields[0] == "BEGIN":
+			s.serveMessages(conn, in)
+			return
+		}
+	}
+}
+
+func (s *fakeSystemdPrivate) serveMessages(conn net.Conn, in *bufio.Reader) {
+	for {
+		msg, err := godbus.DecodeMessage(in)
+		if err != nil {
+			return
+		}
+		if msg.Type != godbus.TypeMethodCall {
+			continue
+		}
+		member, _ := msg.Headers[godbus.FieldMember].Value().(string)
+		s.mtx.Lock()
+		s.members = append(s.members, member)
+		s.mtx.Unlock()
+
+		reply := &godbus.Message{Type: godbus.TypeError, Headers: map[godbus.HeaderField]godbus.Variant{
+			godbus.FieldReplySerial: godbus.MakeVariant(msg.Serial()),
+			godbus.FieldErrorName:   godbus.MakeVariant("org.freedesktop.DBus.Error.UnknownMethod"),
+		}}
+		if member == "ListUnits" {
+			reply = &godbus.Message{Type: godbus.TypeMethodReply, Headers: map[godbus.HeaderField]godbus.Variant{
+				godbus.FieldReplySerial: godbus.MakeVariant(msg.Serial()),
+				godbus.FieldSignature:   godbus.MakeVariant(godbus.SignatureOf(s.units)),
+			}, Body: []interface{}{s.units}}
+		}
+		if msg.Flags&godbus.FlagNoReplyExpected != 0 {
+			continue
+		}
+		if err := reply.EncodeTo(conn, binary.LittleEndian); err != nil {
+			return
+		}
+	}
+}
+
+func TestNewUserManagerConnection(t *testing.T) {
+	root, err := ioutil.TempDir("", "systemd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(prev string) { *rootPath = prev }(*rootPath)
+	*rootPath = root
+	// The user manager is reached with the process' own uid rather than --collector.uid
+	defer func(prev int) { *uid = prev }(*uid)
+	*uid = os.Getuid() + 1
+
+	userUID := os.Getuid()
+	dir := filepath.Join(root, "run/user", strconv.Itoa(userUID), "systemd")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	manager := startFakeSystemdPrivate(t, filepath.Join(dir, "private"), []fakeSystemdUnit{
+		{Name: "foo.service", LoadState: "loaded", ActiveState: "active", SubState: "running", Path: "/org/freedesktop/systemd1/unit/foo_2eservice", JobPath: "/"},
+	})
+	defer manager.Close()
+
+	sockets, err := userManagerSockets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket, ok := sockets[userUID]
+	if !ok {
+		t.Fatalf("Expected user manager socket of %d, got %v", userUID, sockets)
+	}
+	conn, err := newUserManagerConnection(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	units, err := conn.ListUnits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 1 || units[0].Name != "foo.service" {
+		t.Errorf("Bad units of the user manager. Wanted foo.service got %+v", units)
+	}
+
+	manager.mtx.Lock()
+	defer manager.mtx.Unlock()
+	for _, authUID := range manager.uids {
+		if authUID != strconv.Itoa(os.Getuid()) {
+			t.Errorf("Bad uid authenticated to the user manager. Wanted %d got %s", os.Getuid(), authUID)
+		}
+	}
+	// The private socket isn't a bus, so a Hello would fail
+	for _, member := range manager.members {
+		if member == "Hello" {
+			t.Errorf("Expected no Hello on the private socket, got %v", manager.members)
+		}
+	}
+}
+
+func TestUserManagerSockets(t *testing.T) {
+	root, err := ioutil.TempDir("", "systemd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(prev string) { *rootPath = prev }(*rootPath)
+	*rootPath = root
+
+	for _, dir := range []string{"run/user/1000/systemd", "run/user/1001/systemd", "run/user/1002", "run/user/foo/systemd"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A session bus alone doesn't make a user manager reachable
+	for _, path := range []string{"run/user/1000/systemd/private", "run/user/1002/bus"} {
+		listener, err := net.Listen("unix", filepath.Join(root, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+	}
+
+	sockets, err := userManagerSockets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[int]string{1000: filepath.Join(root, "run/user/1000/systemd/private")}
+	if !reflect.DeepEqual(sockets, expected) {
+		t.Errorf("Bad user manager sockets. Wanted %v got %v", expected, sockets)
+	}
+}
+
+func TestNewManagerTargets(t *testing.T) {
+	defer func(prev int) { *uid = prev }(*uid)
+	*uid = 1000
+
+	targets, err := newManagerTargets([]string{"private", "user", "user@1001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]string{
+		{"manager": "system"},
+		{"manager": "user", "uid": "1000"},
+		{"manager": "user", "uid": "1001"},
+	}
+	labels := make([]map[string]string, 0, len(targets))
+	for _, target := range targets {
+		labels = append(labels, target.labels)
+	}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Bad manager target labels. Wanted %v got %v", expected, labels)
+	}
+	// Only the system manager's socket units are bound in the network namespace of PID 1
+	for i, scope := range []managerScope{systemScope, userScope, userScope} {
+		if targets[i].scope != scope {
+			t.Errorf("Bad scope of manager target %s. Wanted %d got %d", targets[i].name, scope, targets[i].scope)
+		}
+	}
+
+	for _, invalid := range [][]string{{"session"}, {"user@foo"}, {"system", "private"}, {"user", "user@1000"}} {
+		if _, err := newManagerTargets(invalid); err == nil {
+			t.Errorf("Expected error for manager targets %v", invalid)
+		}
+	}
+
+	// The default target is labelled after the manager --collector.user connects it to
+	defer func(prev bool) { *enableUserManagers = prev }(*enableUserManagers)
+	defer func(prev bool) { *systemdUser = prev }(*systemdUser)
+	defer func(prev bool) { *systemdPrivate = prev }(*systemdPrivate)
+	*enableUserManagers = true
+	*systemdPrivate = false
+	for user, expected := range map[bool]managerTarget{
+		false: {labels: map[string]string{"manager": "system"}, scope: systemScope},
+		true:  {labels: map[string]string{"manager": "user", "uid": "1000"}, scope: userScope},
+	} {
+		*systemdUser = user
+		targets, err := newManagerTargets(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(targets) != 1 || !reflect.DeepEqual(targets[0].labels, expected.labels) || targets[0].scope != expected.scope {
+			t.Errorf("Bad default manager target with --collector.user=%t. Wanted %+v got %+v", user, expected, targets)
+		}
+	}
+}
+
+func TestIsSystemdPrivateAddress(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected bool
+	}{
+		{"unix:path=/run/systemd/private", true},
+		{"unix:path=/var/lib/machines/foo/run/systemd/private", true},
+		{"unix:path=/var/lib/machines/foo/run/dbus/system_bus_socket", false},
+		{"unix:abstract=/run/systemd/private", false},
+		{"tcp:host=localhost,port=4000", false},
+	}
+	for _, tt := range tests {
+		if got := isSystemdPrivateAddress(tt.address); got != tt.expected {
+			t.Errorf("Bad private address %s. Wanted %t got %t", tt.address, tt.expected, got)
+		}
+	}
+}
+
+// fakeSystemdUnit is a unit as returned by org.freedesktop.systemd1.Manager.ListUnits.
+type fakeSystemdUnit struct {
+	Name, Description, LoadState, ActiveState, SubState, Followed string
+	Path                                                          godbus.ObjectPath
+	JobID                                                         uint32
+	JobType                                                       string
+	JobPath                                                       godbus.ObjectPath
+}
+
+// fakeSystemdManager implements ListUnits of the systemd manager on a bus.
+type fakeSystemdManager struct {
+	units []fakeSystemdUnit
+}
+
+func (m fakeSystemdManager) ListUnits() ([]fakeSystemdUnit, *godbus.Error) {
+	return m.units, nil
+}
+
+func TestProbe(t *testing.T) {
+	root, err := ioutil.TempDir("", "systemd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	bus := filepath.Join(root, "bus")
+	c := &Collector{
+		logger:                log.Base(),
+		unitState:             prometheus.NewDesc("systemd_unit_state", "", []string{"name", "type", "state"}, nil),
+		managerScrapeSuccess:  prometheus.NewDesc("systemd_manager_scrape_success", "", nil, nil),
+		managerScrapeDuration: prometheus.NewDesc("systemd_manager_scrape_duration_seconds", "", nil, nil),
+		unitWhitelistPattern:  regexp.MustCompile("^(?:.+)$"),
+		unitBlacklistPattern:  regexp.MustCompile("^(?:.+\\.(device))$"),
+		dependencyPattern:     regexp.MustCompile("^(?:.+\\.target)$"),
+		probeTargetPattern:    regexp.MustCompile("^(?:" + regexp.QuoteMeta(root) + "/.+)$"),
+	}
+	for _, address := range []string{
+		"",
+		"/run/dbus/system_bus_socket",
+		"unix:/run/dbus/system_bus_socket",
+		"unix:abstract=/tmp/dbus-foo",
+		"tcp:host=localhost,port=4000",
+		"unix:path=" + bus + ",guid=0",
+		"unix:path=/run/dbus/system_bus_socket",
+		"unix:path=" + root + "/a;unix:path=/run/dbus/system_bus_socket",
+		"unix:path=" + root + "/../../../run/dbus/system_bus_socket",
+		"unix:path=" + root + "/../" + filepath.Base(root) + "x/bus",
+		"unix:path=relative/" + root + "/bus",
+	} {
+		if _, err := c.NewProbe(address); err == nil {
+			t.Errorf("Expected error for address %s", address)
+		}
+	}
+
+	// The allowlist applies to the socket the exporter actually connects to
+	machines := &Collector{probeTargetPattern: regexp.MustCompile("^(?:/var/lib/machines/.+)$")}
+	for _, address := range []string{
+		"unix:path=/var/lib/machines/a;unix:path=/run/dbus/system_bus_socket",
+		"unix:path=/var/lib/machines/../../../run/dbus/system_bus_socket",
+	} {
+		if _, err := machines.NewProbe(address); err == nil {
+			t.Errorf("Expected error for address %s", address)
+		}
+	}
+	machineProbe, err := machines.NewProbe("unix:path=/var/lib/machines/a/../b//run/dbus/system_bus_socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "unix:path=/var/lib/machines/b/run/dbus/system_bus_socket"; machineProbe.(*probeCollector).target.name != expected {
+		t.Errorf("Bad probe address. Wanted %s got %s", expected, machineProbe.(*probeCollector).target.name)
+	}
+	// Only what the probed manager reports over D-Bus is collected
+	if scope := machineProbe.(*probeCollector).target.scope; scope != probeScope || scope.sharesHost() {
+		t.Errorf("Bad probe scope. Wanted %d got %d", probeScope, scope)
+	}
+
+	probe, err := c.NewProbe("unix:path=" + bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := gatherProbe(t, probe)
+	if value := metrics["systemd_manager_scrape_success"][""]; value != 0 {
+		t.Errorf("Expected failed probe of missing bus, got success %v", value)
+	}
+
+	defer startDBusDaemon(t, bus)()
+	conn, err := dbusAuthHelloConnection(func(opts ...godbus.ConnOption) (*godbus.Conn, error) {
+		return godbus.Dial("unix:path="+bus, opts...)
+	}, os.Getuid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	manager := fakeSystemdManager{units: []fakeSystemdUnit{
+		{Name: "foo.path", LoadState: "loaded", ActiveState: "active", SubState: "waiting", Path: "/org/freedesktop/systemd1/unit/foo_2epath", JobPath: "/"},
+		{Name: "sda.device", LoadState: "loaded", ActiveState: "active", SubState: "plugged", Path: "/org/freedesktop/systemd1/unit/sda_2edevice", JobPath: "/"},
+	}}
+	if err := conn.Export(manager, "/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager"); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.RequestName("org.freedesktop.systemd1", godbus.NameFlagDoNotQueue); err != nil || reply != godbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("Couldn't own org.freedesktop.systemd1: %v %v", reply, err)
+	}
+
+	metrics = gatherProbe(t, probe)
+	if value := metrics["systemd_manager_scrape_success"][""]; value != 1 {
+		t.Errorf("Expected successful probe, got success %v", value)
+	}
+	expected := map[string]float64{
+		"name=foo.path,state=activating,type=path":   0,
+		"name=foo.path,state=active,type=path":       1,
+		"name=foo.path,state=deactivating,type=path": 0,
+		"name=foo.path,state=inactive,type=path":     0,
+		"name=foo.path,state=failed,type=path":       0,
+	}
+	if !reflect.DeepEqual(metrics["systemd_unit_state"], expected) {
+		t.Errorf("Bad probed unit state. Wanted %v got %v", expected, metrics["systemd_unit_state"])
+	}
+}
+
+// uncheckedCollector hides the descriptors of a collector, as the test collectors only set up the ones they need.
+type uncheckedCollector struct {
+	prometheus.Collector
+}
+
+func (uncheckedCollector) Describe(chan<- *prometheus.Desc) {}
+
+// gatherProbe collects a probe into a fresh registry and returns the values of its metrics by name and labels.
+func gatherProbe(t *testing.T, probe prometheus.Collector) map[string]map[string]float64 {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(uncheckedCollector{probe}); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]map[string]float64{}
+	for _, family := range families {
+		metrics[family.GetName()] = map[string]float64{}
+		for _, metric := range family.Metric {
+			labels := make([]string, 0, len(metric.Label))
+			for _, label := range metric.Label {
+				labels = append(labels, label.GetName()+"="+label.GetValue())
+			}
+			metrics[family.GetName()][strings.Join(labels, ",")] = metric.GetGauge().GetValue()
+		}
+	}
+	return metrics
+}
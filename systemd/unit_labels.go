@@ -0,0 +1,156 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/kadaan/systemd_exporter/cgroup"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	unitFileLabelPrefix = "X-Prometheus-Label-"
+	unitLabelsHelp      = "Labels of the unit from the X-Prometheus-Label- keys of its unit files"
+)
+
+var invalidLabelCharRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// reservedUnitLabelNames are the labels systemd_unit_labels already has, either its own or the ones added to the
+// metrics of every manager with --collector.manager.
+var reservedUnitLabelNames = map[string]struct{}{"name": {}, "manager": {}, "uid": {}}
+
+// isReservedUnitLabelName reports whether a unit file label would clash with a label of systemd_unit_labels or a
+// label name reserved for Prometheus' internal use.
+func isReservedUnitLabelName(name string) bool {
+	if _, ok := reservedUnitLabelNames[name]; ok {
+		return true
+	}
+	return strings.HasPrefix(name, "__")
+}
+
+// sanitizeLabelName turns the suffix of an X-Prometheus-Label- key into a valid Prometheus label name.
+func sanitizeLabelName(name string) string {
+	name = invalidLabelCharRE.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// parseUnitFileLabels applies the X-Prometheus-Label-<name>=<value> keys of the [Unit] section of a unit file to
+// labels. Later assignments override earlier ones, like drop-ins override the fragment, and an empty value removes
+// the label again.
+func parseUnitFileLabels(b []byte, labels map[string]string) error {
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	var line string
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		// A trailing backslash continues the line, it is replaced by a space
+		if strings.HasSuffix(text, `\`) {
+			line += strings.TrimSuffix(text, `\`) + " "
+			continue
+		}
+		line, text = "", line+text
+		if text == "" || text[0] == '#' || text[0] == ';' {
+			continue
+		}
+		if text[0] == '[' && text[len(text)-1] == ']' {
+			section = text[1 : len(text)-1]
+			continue
+		}
+		if section != "Unit" {
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || !strings.HasPrefix(key, unitFileLabelPrefix) {
+			continue
+		}
+		labelName := sanitizeLabelName(strings.TrimPrefix(key, unitFileLabelPrefix))
+		if labelName == "" || isReservedUnitLabelName(labelName) {
+			continue
+		}
+		if value := strings.TrimSpace(parts[1]); value != "" {
+			labels[labelName] = value
+		} else {
+			delete(labels, labelName)
+		}
+	}
+	return scanner.Err()
+}
+
+// collectUnitFileLabels reports the X-Prometheus-Label- keys of a unit's fragment and drop-ins as labels of
+// systemd_unit_labels, so owners can annotate their units with e.g. their team. Only the first labels by name up to
+// --collector.unit-file-labels.limit are kept.
+func (c *Collector) collectUnitFileLabels(ch chan<- prometheus.Metric, unit dbus.UnitStatus, properties map[string]interface{}) error {
+	paths, err := unitFilePaths(properties)
+	if err != nil {
+		return err
+	}
+
+	labels := make(map[string]string)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		b, err := cgroup.ReadFileNoStat(rootfsFilePath(path))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrapf(err, "couldn't read unit file %s", path)
+		}
+		if err := parseUnitFileLabels(b, labels); err != nil {
+			return errors.Wrapf(err, "couldn't parse unit file %s", path)
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+
+	labelNames := make([]string, 0, len(labels))
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+	if len(labelNames) > *unitFileLabelsLimit {
+		c.logger.With("unit", unit.Name).Warnf("dropping %d unit file labels over the limit of %d", len(labelNames)-*unitFileLabelsLimit, *unitFileLabelsLimit)
+		labelNames = labelNames[:*unitFileLabelsLimit]
+	}
+	labelValues := make([]string, 0, len(labelNames)+1)
+	labelValues = append(labelValues, unit.Name)
+	for _, labelName := range labelNames {
+		labelValues = append(labelValues, labels[labelName])
+	}
+
+	// The label names differ between units, so the descriptor is created per unit and isn't part of Describe
+	desc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unit_labels"),
+		unitLabelsHelp,
+		append([]string{"name"}, labelNames...), nil,
+	)
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1.0, labelValues...)
+	return nil
+}
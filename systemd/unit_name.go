@@ -0,0 +1,57 @@
+// Copyright © 2021 Joel Baranick <jbaranick@gmail.com>
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseUnitTemplate splits an instantiated unit name such as getty@tty1.service into its template getty@.service and
+// its unescaped instance tty1. Units which are not instantiated from a template return empty strings.
+func parseUnitTemplate(name string) (string, string) {
+	at := strings.Index(name, "@")
+	dot := strings.LastIndex(name, ".")
+	if at < 0 || dot < at {
+		return "", ""
+	}
+	return name[:at+1] + name[dot:], unescapeUnitName(name[at+1 : dot])
+}
+
+// unescapeUnitName reverses the \xNN escaping systemd applies to unit name parts, like systemd-escape --unescape.
+// Invalid escape sequences are kept verbatim, and so is the whole name if unescaping it doesn't yield valid UTF-8, which
+// label values must be.
+func unescapeUnitName(s string) string {
+	if !strings.Contains(s, `\x`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if v, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	if !utf8.ValidString(b.String()) {
+		return s
+	}
+	return b.String()
+}